@@ -0,0 +1,63 @@
+package benchmarker
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/curtisnewbie/miso/util/expr"
+)
+
+const (
+	// key in Benchmark.Extra, the assertion that is failed.
+	ExtraAssertionFailed = "ASSERTION_FAILED"
+)
+
+// env of assertion (BenchmarkSpec.Assert).
+type assertionEnv struct {
+	Status  int               `expr:"status"`  // http status code
+	Body    any               `expr:"body"`    // decoded json body, or the raw body as string if it's not json
+	Headers map[string]string `expr:"headers"` // response headers, header names are in lowercase, e.g., headers["content-type"]
+}
+
+// compile assertion (BenchmarkSpec.Assert) as afterResponseFunc, nil is returned if assertion is empty.
+func compileAssertion(assertion string) (afterResponseFunc, error) {
+	assertion = strings.TrimSpace(assertion)
+	if assertion == "" {
+		return nil, nil
+	}
+	ex, err := expr.CompileEnv(assertion, assertionEnv{})
+	if err != nil {
+		return nil, errs.WrapErrf(err, "invalid assertion '%v'", assertion)
+	}
+
+	return func(res *http.Response, buf []byte, r *Result) {
+		if !r.Success {
+			return
+		}
+		out, err := ex.Eval(newAssertionEnv(res, buf))
+		if pass, ok := out.(bool); err == nil && ok && pass {
+			return
+		}
+		r.Success = false
+		if r.Extra == nil {
+			r.Extra = map[string]any{}
+		}
+		r.Extra[ExtraAssertionFailed] = assertion
+		if err != nil {
+			r.Extra["ERROR"] = err.Error()
+		}
+	}, nil
+}
+
+func newAssertionEnv(res *http.Response, buf []byte) assertionEnv {
+	env := assertionEnv{Status: res.StatusCode, Headers: make(map[string]string, len(res.Header))}
+	if err := json.ParseJson(buf, &env.Body); err != nil {
+		env.Body = string(buf)
+	}
+	for k := range res.Header {
+		env.Headers[strings.ToLower(k)] = res.Header.Get(k)
+	}
+	return env
+}
@@ -2,16 +2,23 @@ package benchmarker
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"os/signal"
 	"reflect"
 	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/curtisnewbie/miso/encoding/json"
@@ -35,33 +42,77 @@ var (
 	defPlotSortedByRequestOrderFilename = "plot_sorted_by_request_order.png"
 	defPlotSortedByLatencyFilename      = "plot_sorted_by_latency.png"
 	defPlotSuccessRateFilename          = "plot_success_rate.png"
+	defPlotThroughputFilename           = "plot_throughput.png"
+	defPlotLatencyOverTimeFilename      = "plot_latency_over_time.png"
+	defPlotErrorRateFilename            = "plot_error_rate.png"
+	defPlotHistogramFilename            = "plot_latency_histogram.png"
+	defPlotCdfFilename                  = "plot_latency_cdf.png"
 	defDataOutputFilename               = "benchmark_records.txt"
+	defHtmlReportFilename               = "benchmark_report.html"
+)
+
+var (
+	percentileValues = []int{75, 90, 95, 99}
+
+	// last send time handed out by uniqueUnixNano.
+	lastSendUnixNano atomic.Int64
 )
 
 const (
 	// rough estimate on how many benchmark results will be created by one goroutine, increase it if necessary.
 	DefaultResultQueueSize = 1000
+
+	// exit code of benchmarker CLI when the benchmark is interrupted (e.g., Ctrl-C).
+	ExitCodeInterrupted = 130
+)
+
+var (
+	// BuildRequestFunc may return ErrNoMoreRequests to stop the benchmark early, e.g., all requests in the replay file are sent.
+	ErrNoMoreRequests = errs.NewErrf("No more requests").WithCode("NO_MORE_REQUESTS")
+
+	// returned when the context is cancelled before the benchmark is completed, the partial results are still reported.
+	ErrInterrupted = errs.NewErrf("Benchmark interrupted").WithCode("INTERRUPTED")
 )
 
 type BuildRequestFunc func() (*http.Request, error)
 type ParseResponseFunc func(buf []byte, statusCode int) Result
 
-func doSend(c *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFunc) (Result, time.Time) {
-	errResult := func(err error, httpStatus int) (Result, time.Time) {
+// send request over other protocols (e.g., gRPC), error is only used to stop the benchmark early (ErrNoMoreRequests),
+// other errors are recorded as unsuccessful requests.
+//
+// ctx is done once the benchmark is interrupted, in-flight requests should be cancelled.
+type InvokeFunc func(ctx context.Context) (Result, error)
+
+// called after the response is parsed, it may modify the Result, e.g., extract values from the response of a journey step.
+type afterResponseFunc func(res *http.Response, buf []byte, r *Result)
+
+// send request, error is only returned if buildReq returns ErrNoMoreRequests, i.e., nothing is sent.
+//
+// The request is cancelled once ctx is done.
+func doSend(ctx context.Context, c *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFunc, afterRes afterResponseFunc, timing *httpTiming) (Result, time.Time, error) {
+	errResult := func(err error, httpStatus int) (Result, time.Time, error) {
 		return Result{
 			HttpStatus: httpStatus,
 			Success:    false,
 			Extra: map[string]any{
 				"ERROR": err.Error(),
 			},
-		}, time.Now()
+		}, time.Now(), nil
 	}
 
 	req, err := buildReq()
 	if err != nil {
+		if errors.Is(err, ErrNoMoreRequests) {
+			return Result{}, time.Time{}, err
+		}
 		miso.Errorf("Build Request failed, %v", err)
 		return errResult(err, 0)
 	}
+	rctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	req = req.WithContext(httptrace.WithClientTrace(rctx, timing.clientTrace()))
 
 	res, err := c.Do(req)
 	if err != nil {
@@ -70,6 +121,7 @@ func doSend(c *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFun
 		}
 		return errResult(err, 0)
 	}
+	defer res.Body.Close()
 
 	buf, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -79,10 +131,19 @@ func doSend(c *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFun
 
 	r := parseRes(buf, res.StatusCode)
 	r.HttpStatus = res.StatusCode
-	return r, end
+	if afterRes != nil {
+		afterRes(res, buf, &r)
+	}
+	return r, end, nil
 }
 
+// Deprecated: it's not used by the benchmark, use StartFuncBenchmark for non-HTTP workloads instead.
 type SendRequestFunc func(c *http.Client) Result
+
+// workload benchmarked by StartFuncBenchmark, e.g., database queries, redis calls, kafka produces or in-process function calls.
+//
+// Result.HttpStatus is recorded as the status code, it can be any code that is meaningful to the workload (e.g., 0 for OK).
+type BenchmarkFunc func(ctx context.Context) Result
 type LogExtraStatFunc func([]Benchmark) string
 
 type BenchmarkSpec struct {
@@ -90,12 +151,62 @@ type BenchmarkSpec struct {
 	Round      int
 	Duration   time.Duration
 
-	// required, func to build benchmark request
+	// optional, constant arrival rate (requests/sec).
+	//
+	// If Rate is specified, requests are sent on a fixed timeline regardless of response time (open-loop),
+	// and Round becomes the total number of requests instead of the number of requests for each worker.
+	Rate float64
+
+	// optional, max number of workers used to sustain the Rate, by default it's Concurrent or Rate (enough for latency up to 1s), whichever is larger.
+	//
+	// Concurrent workers are started (and warmed up) before the benchmark, more workers are started on demand when all of them are busy.
+	MaxWorkers int
+
+	// optional, staged load profile (e.g., ramp-up, hold, ramp-down).
+	//
+	// If Stages is specified, the number of active workers is ramped linearly between stages,
+	// Concurrent becomes the max Target of all stages, and Duration becomes the total duration of all stages.
+	Stages []Stage
+
+	// Stage.Target is the arrival rate (req/sec) instead of the number of active workers, Rate becomes the max Target of all stages.
+	StageByRate bool
+
+	// required unless Scenarios, InvokeFunc or WebSocket is specified, func to build benchmark request
 	BuildReqFunc BuildRequestFunc
 
+	// optional, func to send request over other protocols (e.g., GrpcInvoker.Invoke), it's used instead of BuildReqFunc and ParseResFunc.
+	//
+	// Result.HttpStatus is recorded as the status code (e.g., gRPC status code). It's mutually exclusive with Scenarios.
+	InvokeFunc InvokeFunc
+
+	// optional, weighted traffic mix, each request is drawn by weight from the scenarios and tagged with the scenario name.
+	//
+	// Stats, the report and the plots are broken down by scenario as well as in aggregate.
+	Scenarios []Scenario
+
+	// optional, benchmark messages over long-lived WebSocket connections, it's mutually exclusive with BuildReqFunc, InvokeFunc and Scenarios.
+	//
+	// Connect time and message counters are reported in Stats.WebSocket. See WebSocketSpec.
+	WebSocket *WebSocketSpec
+
+	// optional, func to build the warmup request sent by each worker before the benchmark, by default BuildReqFunc is used.
+	WarmupReqFunc BuildRequestFunc
+
+	// do not send warmup requests, e.g., when requests have side effects and each of them must only be sent once (see Replayer).
+	DisableWarmup bool
+
 	// optional, by default, it considers 200 as a success.
 	ParseResFunc ParseResponseFunc
 
+	// optional, assertion expr evaluated against the http response, e.g., 'body.error == false && len(body.data) > 0'.
+	//
+	// The env includes status, body (decoded json, or raw body as string if it's not json) and headers (names are in lowercase).
+	// It's only evaluated if ParseResFunc considers the request successful, the request is unsuccessful if the assertion is false,
+	// and the assertion is recorded in Benchmark.Extra (ExtraAssertionFailed).
+	//
+	// It's not supported with InvokeFunc or WebSocket.
+	Assert string
+
 	// funcs to log extra statistics information
 	LogStatFunc []LogExtraStatFunc
 
@@ -108,9 +219,65 @@ type BenchmarkSpec struct {
 	// do not draw percentile lines on graph
 	DisablePlotInclPercentileLines bool
 
+	// width of the time buckets of throughput, latency percentiles and error rate over time plots, by default 1s.
+	PlotBucketWidth time.Duration
+
+	// optional, split latency histogram and cdf plots by http status (PlotSplitByStatus) or success (PlotSplitBySuccess).
+	PlotSplitBy string
+
 	// do not write benchmark records to file
 	DisableOutputFile bool
 
+	// format of the data output file: text (default), json, csv or ndjson.
+	//
+	// For csv, stats are written to a separate file named '{DataOutputFilename without suffix}_stats.csv'.
+	OutputFormat string
+
+	// compute statistics using HDR-style histograms with bounded memory instead of retaining every Benchmark record,
+	// records are only retained when plots, data file, html report, SaveRunFilename or LogStatFunc are enabled.
+	StreamStats bool
+
+	// optional, save stats and latency samples of the run to the file (json), that can be compared with other runs using CompareRuns.
+	SaveRunFilename string
+
+	// generate a self-contained html report, including summary, percentiles, interactive charts, run configuration and output of LogStatFunc.
+	HtmlReport bool
+
+	// optional, interval of live progress (elapsed/remaining time, rps, rolling p50/p99, error rate and status code counts)
+	// printed during the benchmark, progress is printed in place if stdout is a terminal, by default it's disabled.
+	ProgressInterval time.Duration
+
+	// optional, address of the embedded http endpoint (e.g., ':9100') that exposes live metrics (request counters by status and success,
+	// in-flight gauge and latency histograms) in Prometheus exposition format at '/metrics' while the benchmark is running.
+	MetricsAddr string
+
+	// optional, how long the metrics endpoint keeps serving after the benchmark, so that the final values are scraped,
+	// it should be at least one scrape interval, by default DefaultMetricsLinger. The benchmark returns after the linger,
+	// it's cut short if the ctx is done, and a negative value stops serving immediately.
+	MetricsLinger time.Duration
+
+	// optional, sinks that receive the Benchmark records as they are recorded, e.g., InfluxSink and OtlpSink.
+	//
+	// Records are buffered (at most SinkBufferSize records) and written in batches (at most SinkBatchSize records
+	// or every SinkFlushInterval) by a dedicated goroutine for each sink, records are dropped if the buffer is full.
+	Sinks             []Sink
+	SinkBatchSize     int           // by default 1000
+	SinkFlushInterval time.Duration // by default 1s
+	SinkBufferSize    int           // by default 100k
+
+	// optional, custom reporters that receive the progress and results of the benchmark, they are called after the built-in
+	// reporters (console output, data file, html report, saved run and plots), see Reporter.
+	//
+	// Snapshots are taken every ProgressInterval, or every DefaultSnapshotInterval if ProgressInterval is not specified.
+	// Records are passed to Reporter.Record by a dedicated goroutine in batches the same way as Sinks (SinkBufferSize,
+	// SinkBatchSize and SinkFlushInterval), records are dropped if the reporters can't keep up.
+	Reporters []Reporter
+
+	// optional, thresholds (SLO) evaluated against Stats after the benchmark, e.g., 'p99 < 200ms', 'error_rate < 0.01', 'throughput > 500'.
+	//
+	// If any threshold is breached, ErrThresholdBreached is returned. See Threshold for supported metrics.
+	Thresholds []string
+
 	// rough estimate on how many benchmark results will be created by one worker, by default 1000.
 	SingleWorkerResultQueueSize int
 
@@ -119,19 +286,64 @@ type BenchmarkSpec struct {
 	PlotSortedByRequestOrderFilename string
 	PlotSortedByLatencyFilename      string
 	PlotSuccessRateFilename          string
+	PlotThroughputFilename           string
+	PlotLatencyOverTimeFilename      string
+	PlotErrorRateFilename            string
+	PlotHistogramFilename            string
+	PlotCdfFilename                  string
+	PlotConcGroupThroughputFilename  string // only used by StartConcGroupBenchmark
+	PlotConcGroupLatencyFilename     string // only used by StartConcGroupBenchmark
 	DataOutputFilename               string
-
-	benchmarkTime string
+	HtmlReportFilename               string
+
+	benchmarkTime  string
+	thresholds     []Threshold
+	scenarioPicker *scenarioPicker
+	assertRes      afterResponseFunc
+	wsCollector    *wsCollector
+	ctx            context.Context
 }
 
 func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
-	if spec.BuildReqFunc == nil {
+	return StartBenchmarkContext(context.Background(), spec)
+}
+
+// Same as StartBenchmark, but the benchmark is stopped once ctx is done, in-flight requests are cancelled and discarded.
+//
+// The partial results are still reported (e.g., stats, data file, plots and html report) and marked as interrupted (Stats.Interrupted),
+// ErrInterrupted is returned along with the partial results.
+func StartBenchmarkContext(ctx context.Context, spec BenchmarkSpec) ([]Benchmark, Stats, error) {
+	spec.ctx = ctx
+	if spec.BuildReqFunc == nil && spec.InvokeFunc == nil && len(spec.Scenarios) < 1 && spec.WebSocket == nil {
 		panic(fmt.Errorf("BuildReqFunc is required for the benchmark"))
 	}
+	if spec.InvokeFunc != nil && len(spec.Scenarios) > 0 {
+		return nil, Stats{}, errs.NewErrf("InvokeFunc and Scenarios are mutually exclusive")
+	}
+	if spec.Assert != "" && (spec.InvokeFunc != nil || spec.WebSocket != nil) {
+		return nil, Stats{}, errs.NewErrf("Assert is only supported for http responses, it's not supported with InvokeFunc or WebSocket")
+	}
+	if spec.WebSocket != nil {
+		if spec.BuildReqFunc != nil || spec.InvokeFunc != nil || len(spec.Scenarios) > 0 {
+			return nil, Stats{}, errs.NewErrf("WebSocket is mutually exclusive with BuildReqFunc, InvokeFunc and Scenarios")
+		}
+		if err := prepareWebSocket(&spec); err != nil {
+			return nil, Stats{}, err
+		}
+	}
 	if spec.SingleWorkerResultQueueSize < 1 {
 		spec.SingleWorkerResultQueueSize = DefaultResultQueueSize
 	}
 
+	if len(spec.Stages) > 0 {
+		spec.Duration = stagesDuration(spec.Stages)
+		if spec.StageByRate {
+			spec.Rate = float64(stagesMaxTarget(spec.Stages))
+		} else {
+			spec.Concurrent = stagesMaxTarget(spec.Stages)
+		}
+	}
+
 	durBased := false
 	if spec.Duration > 0 {
 		durBased = true
@@ -143,6 +355,9 @@ func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
 	if spec.Concurrent < 1 {
 		spec.Concurrent = 1
 	}
+	if spec.Rate > 0 && spec.MaxWorkers < 1 {
+		spec.MaxWorkers = max(spec.Concurrent, int(math.Ceil(spec.Rate)))
+	}
 
 	if spec.PlotWidth == 0 {
 		spec.PlotWidth = defPlotWidth
@@ -159,8 +374,52 @@ func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
 	if spec.PlotSuccessRateFilename == "" {
 		spec.PlotSuccessRateFilename = defPlotSuccessRateFilename
 	}
+	if spec.PlotThroughputFilename == "" {
+		spec.PlotThroughputFilename = defPlotThroughputFilename
+	}
+	if spec.PlotLatencyOverTimeFilename == "" {
+		spec.PlotLatencyOverTimeFilename = defPlotLatencyOverTimeFilename
+	}
+	if spec.PlotErrorRateFilename == "" {
+		spec.PlotErrorRateFilename = defPlotErrorRateFilename
+	}
+	if spec.PlotHistogramFilename == "" {
+		spec.PlotHistogramFilename = defPlotHistogramFilename
+	}
+	if spec.PlotCdfFilename == "" {
+		spec.PlotCdfFilename = defPlotCdfFilename
+	}
+	if spec.PlotBucketWidth <= 0 {
+		spec.PlotBucketWidth = defPlotBucketWidth
+	}
+	if !isValidPlotSplitBy(spec.PlotSplitBy) {
+		return nil, Stats{}, errs.NewErrf("Invalid PlotSplitBy '%v', must be one of '%v' and '%v'", spec.PlotSplitBy, PlotSplitByStatus, PlotSplitBySuccess)
+	}
+	if spec.OutputFormat == "" {
+		spec.OutputFormat = OutputFormatText
+	}
+	if !isValidOutputFormat(spec.OutputFormat) {
+		return nil, Stats{}, errs.NewErrf("Invalid output format '%v', must be one of text, json, csv and ndjson", spec.OutputFormat)
+	}
 	if spec.DataOutputFilename == "" {
-		spec.DataOutputFilename = defDataOutputFilename
+		spec.DataOutputFilename = defaultDataOutputFilename(spec.OutputFormat)
+	}
+	if spec.HtmlReportFilename == "" {
+		spec.HtmlReportFilename = defHtmlReportFilename
+	}
+	if spec.MetricsLinger == 0 {
+		spec.MetricsLinger = DefaultMetricsLinger
+	}
+	thresholds, err := ParseThresholds(spec.Thresholds)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	if err := checkThresholds(thresholds, spec); err != nil {
+		return nil, Stats{}, err
+	}
+	spec.thresholds = thresholds
+	if spec.assertRes, err = compileAssertion(spec.Assert); err != nil {
+		return nil, Stats{}, err
 	}
 	if spec.ParseResFunc == nil {
 		spec.ParseResFunc = func(buf []byte, statusCode int) Result {
@@ -169,8 +428,108 @@ func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
 			}
 		}
 	}
+	if len(spec.Scenarios) > 0 {
+		scenarios, err := prepareScenarios(spec.Scenarios, spec.ParseResFunc)
+		if err != nil {
+			return nil, Stats{}, err
+		}
+		spec.Scenarios = scenarios
+		spec.scenarioPicker = newScenarioPicker(scenarios)
+		if spec.BuildReqFunc == nil {
+			// nil if scenarios[0] is a journey, the journey is used for warmup instead
+			spec.BuildReqFunc = scenarios[0].BuildReqFunc
+		}
+	}
+	if spec.WarmupReqFunc == nil {
+		spec.WarmupReqFunc = spec.BuildReqFunc
+	}
 	spec.benchmarkTime = util.Now().FormatClassicLocale()
 
+	util.DebugPrintlnf(spec.DebugLog, "Creating workers: %v", time.Now())
+
+	reporters := buildReporters(spec)
+	run := RunInfo{Spec: spec, StartTime: time.Now()}
+	for _, r := range reporters {
+		if err := r.Start(run); err != nil {
+			return nil, Stats{}, err
+		}
+	}
+
+	rec := newRecorder(spec)
+	if rec.metrics, err = startMetrics(spec); err != nil {
+		return nil, Stats{}, err
+	}
+	defer rec.metrics.close(ctx) // final values are scraped during the linger
+	rec.sinks = startSinks(spec)
+	rec.reporters = startReporterPipeline(spec)
+	snapshots := startSnapshots(spec, rec, durBased, reporters)
+	var (
+		benchmarks []Benchmark
+		startTime  time.Time
+	)
+	if spec.WebSocket != nil {
+		benchmarks, startTime = runWebSocket(spec, durBased, rec)
+	} else if spec.Rate > 0 {
+		benchmarks, startTime = runOpenLoop(spec, durBased, rec)
+	} else {
+		benchmarks, startTime = runClosedLoop(spec, durBased, rec)
+	}
+	snapshots.close()
+
+	endTime := time.Now()
+	util.DebugPrintlnf(spec.DebugLog, "Benchmark endTime: %v", endTime)
+	sinkStats := closeSinks(rec.sinks) // draining the sinks is not included in the total time
+	closeReporterPipeline(rec.reporters)
+
+	stats := buildStats(spec, benchmarks, rec, endTime.Sub(startTime), sinkStats)
+	if !rec.keepRecords {
+		benchmarks = nil
+	}
+
+	report := Report{RunInfo: run, Stats: stats, Benchmarks: benchmarks}
+	for _, r := range reporters {
+		if err := r.Finish(report); err != nil {
+			return benchmarks, stats, err
+		}
+	}
+	util.Printlnf("\n-------------------------------\n")
+
+	if stats.Interrupted {
+		return benchmarks, stats, ErrInterrupted.WithInternalMsg("%v", ctx.Err())
+	}
+	if failed := failedThresholds(stats.Thresholds); len(failed) > 0 {
+		return benchmarks, stats, ErrThresholdBreached.WithInternalMsg("%v", strings.Join(failed, ", "))
+	}
+	return benchmarks, stats, nil
+}
+
+// Benchmark non-HTTP workload, f is called by the workers (including warmup) instead of sending http requests.
+//
+// The worker pool, Rate, Stages, stats, plots, data file and html report work the same as StartBenchmark.
+// BuildReqFunc, InvokeFunc, Scenarios, WebSocket and Assert are not supported.
+func StartFuncBenchmark(spec BenchmarkSpec, f BenchmarkFunc) ([]Benchmark, Stats, error) {
+	return StartFuncBenchmarkContext(context.Background(), spec, f)
+}
+
+// Same as StartFuncBenchmark, but the benchmark is stopped once ctx is done, ctx is also passed to f. See StartBenchmarkContext.
+func StartFuncBenchmarkContext(ctx context.Context, spec BenchmarkSpec, f BenchmarkFunc) ([]Benchmark, Stats, error) {
+	if f == nil {
+		panic(fmt.Errorf("BenchmarkFunc is required for the benchmark"))
+	}
+	if spec.BuildReqFunc != nil || spec.InvokeFunc != nil || len(spec.Scenarios) > 0 || spec.WebSocket != nil {
+		return nil, Stats{}, errs.NewErrf("BuildReqFunc, InvokeFunc, Scenarios and WebSocket are not supported in StartFuncBenchmark")
+	}
+	if spec.Assert != "" {
+		return nil, Stats{}, errs.NewErrf("Assert is not supported in StartFuncBenchmark")
+	}
+	spec.InvokeFunc = func(ctx context.Context) (Result, error) {
+		return f(ctx), nil
+	}
+	return StartBenchmarkContext(ctx, spec)
+}
+
+// closed-loop, each worker sends the next request as soon as the previous one is completed.
+func runClosedLoop(spec BenchmarkSpec, durBased bool, rec *recorder) ([]Benchmark, time.Time) {
 	pool := util.NewAsyncPool(spec.Concurrent, spec.Concurrent)
 	aw := util.NewAwaitFutures[[]Benchmark](pool)
 
@@ -179,60 +538,50 @@ func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
 
 	var startTimeOnce sync.Once
 	var startTime time.Time
-	util.DebugPrintlnf(spec.DebugLog, "Creating workers: %v", time.Now())
-
-	var cmu sync.Mutex
-	var successCount int64 = 0
-	var failCount int64 = 0
-
-	updateCount := func(success bool) float64 {
-		cmu.Lock()
-		if success {
-			successCount += 1
-		} else {
-			failCount += 1
-		}
-		s := successCount
-		f := failCount
-		cmu.Unlock()
-
-		return float64(s) / float64(s+f)
-	}
 
 	for i := 0; i < spec.Concurrent; i++ {
 		wi := i
 		aw.SubmitAsync(func() ([]Benchmark, error) {
-			client := newClient()
+			capacity := spec.Round
+			if durBased {
+				capacity = spec.SingleWorkerResultQueueSize
+			}
+			w := newWorker(&spec, rec, capacity)
 			func() {
 				defer warmupWg.Done()
-				triggerOnce(client, spec.BuildReqFunc, spec.ParseResFunc)
+				w.warmup()
 			}()
 			warmupWg.Wait() // synchronize all of them
 
 			startTimeOnce.Do(func() { startTime = time.Now() })
 			util.DebugPrintlnf(spec.DebugLog, "Worker-%d start ramping: %v", wi, time.Now())
 
-			var localStore []Benchmark
-			if durBased {
-				localStore = make([]Benchmark, 0, spec.SingleWorkerResultQueueSize)
-			} else {
-				localStore = make([]Benchmark, 0, spec.Round)
-			}
-
-			if durBased {
+			if len(spec.Stages) > 0 {
+				for elapsed := time.Since(startTime); elapsed <= spec.Duration; elapsed = time.Since(startTime) {
+					if float64(wi) >= stageTarget(spec.Stages, elapsed) {
+						if !sleepCtx(spec.ctx, stagePollInterval) { // inactive in current stage
+							break
+						}
+						continue
+					}
+					if err := w.send(time.Time{}); err != nil {
+						break // no more requests or interrupted
+					}
+				}
+			} else if durBased {
 				for time.Since(startTime) <= spec.Duration {
-					b := triggerOnce(client, spec.BuildReqFunc, spec.ParseResFunc)
-					b.successRate = updateCount(b.Success)
-					localStore = append(localStore, b)
+					if err := w.send(time.Time{}); err != nil {
+						break // no more requests or interrupted
+					}
 				}
 			} else {
 				for j := 0; j < spec.Round; j++ {
-					b := triggerOnce(client, spec.BuildReqFunc, spec.ParseResFunc)
-					b.successRate = updateCount(b.Success)
-					localStore = append(localStore, b)
+					if err := w.send(time.Time{}); err != nil {
+						break // no more requests or interrupted
+					}
 				}
 			}
-			return localStore, nil
+			return w.records, nil
 		})
 	}
 
@@ -242,54 +591,261 @@ func StartBenchmark(spec BenchmarkSpec) ([]Benchmark, Stats, error) {
 	} else {
 		size = spec.Concurrent * spec.SingleWorkerResultQueueSize
 	}
+	benchmarks := collectBenchmarks(aw, rec, size)
+	return benchmarks, startTime
+}
+
+// open-loop, requests are scheduled on a fixed timeline (based on spec.Rate) regardless of response time.
+//
+// Scheduled requests are picked up by a pool of workers, workers are started on demand (up to spec.MaxWorkers) when all of them
+// are busy, if the pool is full, requests are queued until a worker is available, the timeline itself is not affected.
+func runOpenLoop(spec BenchmarkSpec, durBased bool, rec *recorder) ([]Benchmark, time.Time) {
+	p := newOpenLoopPool(&spec, rec)
+	p.warmup(min(spec.Concurrent, spec.MaxWorkers))
+
+	startTime := time.Now()
+	util.DebugPrintlnf(spec.DebugLog, "Start dispatching requests at %.2f req/sec: %v", spec.Rate, startTime)
+
+	if len(spec.Stages) > 0 {
+		dispatchStagedRate(spec.ctx, spec.Stages, startTime, p.dispatch)
+	} else {
+		interval := float64(time.Second) / spec.Rate
+		for i := 0; ; i++ {
+			next := startTime.Add(time.Duration(float64(i) * interval))
+			if durBased {
+				if next.Sub(startTime) > spec.Duration {
+					break
+				}
+			} else if i >= spec.Round {
+				break
+			}
+			if !sleepCtx(spec.ctx, time.Until(next)) || !p.dispatch(next) {
+				break
+			}
+		}
+	}
+	close(p.schedule)
+
+	// record capacity is allocated for the whole run rather than for each worker
+	size := spec.Round
+	if durBased {
+		size = int(math.Ceil(spec.Rate * spec.Duration.Seconds()))
+	}
+	return collectBenchmarks(p.aw, rec, size), startTime
+}
+
+// pool of open-loop workers, workers are started on demand.
+type openLoopPool struct {
+	spec          *BenchmarkSpec
+	rec           *recorder
+	aw            *util.AwaitFutures[[]Benchmark]
+	schedule      chan time.Time
+	exhausted     chan struct{} // closed when BuildReqFunc returns ErrNoMoreRequests or the benchmark is interrupted
+	exhaustedOnce sync.Once
+	idle          atomic.Int64 // workers that are not sending requests
+	workers       int          // only accessed by the dispatcher
+}
+
+func newOpenLoopPool(spec *BenchmarkSpec, rec *recorder) *openLoopPool {
+	return &openLoopPool{
+		spec:      spec,
+		rec:       rec,
+		aw:        util.NewAwaitFutures[[]Benchmark](util.NewAsyncPool(spec.MaxWorkers, spec.MaxWorkers)),
+		schedule:  make(chan time.Time, spec.MaxWorkers),
+		exhausted: make(chan struct{}),
+	}
+}
+
+// start n workers and wait until all of them are warmed up.
+func (p *openLoopPool) warmup(n int) {
+	var warmupWg sync.WaitGroup
+	warmupWg.Add(n)
+	for i := 0; i < n; i++ {
+		p.spawn(&warmupWg)
+	}
+	warmupWg.Wait() // synchronize all of them
+}
+
+// start a worker, the worker sends warmup request only if warmupWg is not nil, i.e., before the benchmark starts.
+func (p *openLoopPool) spawn(warmupWg *sync.WaitGroup) {
+	wi := p.workers
+	p.workers++
+	p.idle.Add(1) // idle once it's started
+	p.aw.SubmitAsync(func() ([]Benchmark, error) {
+		w := newWorker(p.spec, p.rec, 0)
+		if warmupWg != nil {
+			w.warmup()
+			warmupWg.Done()
+		}
+		util.DebugPrintlnf(p.spec.DebugLog, "Worker-%d ready: %v", wi, time.Now())
+
+		for intended := range p.schedule {
+			p.idle.Add(-1)
+			err := w.send(intended)
+			p.idle.Add(1)
+			if err != nil {
+				// keep draining the schedule until the dispatcher stops
+				p.exhaustedOnce.Do(func() { close(p.exhausted) })
+			}
+		}
+		return w.records, nil
+	})
+}
+
+// dispatch the scheduled request, a new worker is started if all of them are busy, returns false if the dispatcher should stop.
+func (p *openLoopPool) dispatch(next time.Time) bool {
+	if p.workers < p.spec.MaxWorkers && p.idle.Load() <= int64(len(p.schedule)) {
+		p.spawn(nil)
+	}
+	select {
+	case p.schedule <- next:
+		return true
+	case <-p.exhausted:
+		return false
+	case <-p.spec.ctx.Done():
+		return false
+	}
+}
+
+// sleep for d, returns false if ctx is done before d elapses.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func collectBenchmarks(aw *util.AwaitFutures[[]Benchmark], rec *recorder, size int) []Benchmark {
+	if !rec.keepRecords {
+		size = 0
+	}
 	benchmarks := make([]Benchmark, 0, size)
 	futures := aw.Await()
 	for _, f := range futures {
 		b, _ := f.Get()
 		benchmarks = append(benchmarks, b...)
 	}
+	return benchmarks
+}
 
-	endTime := time.Now()
-	util.DebugPrintlnf(spec.DebugLog, "Benchmark endTime: %v", endTime)
+// worker (i.e., virtual user) that sends requests and retains the records.
+type worker struct {
+	spec    *BenchmarkSpec
+	client  *http.Client
+	rec     *recorder
+	vars    map[string]any // values extracted from responses of steps of the current journey
+	records []Benchmark
+}
 
-	stats, err := printStats(spec, benchmarks, endTime.Sub(startTime), spec.LogStatFunc...)
-	if err != nil {
-		return benchmarks, stats, err
+func newWorker(spec *BenchmarkSpec, rec *recorder, capacity int) *worker {
+	w := &worker{spec: spec, rec: rec, vars: map[string]any{}}
+	if spec.WebSocket == nil { // WebSocket connections are established by wsConn
+		w.client = newClient()
+	}
+	if rec.keepRecords {
+		w.records = make([]Benchmark, 0, capacity)
 	}
+	return w
+}
 
-	if !spec.DisablePlotGraphs {
-		util.Printlnf("\n--------- Plots ---------------\n")
+// send warmup request (or the first journey if there is no request to send), the result is not recorded.
+func (w *worker) warmup() {
+	switch {
+	case w.spec.DisableWarmup: // nothing to send
+	case w.spec.WarmupReqFunc != nil:
+		_, _ = triggerOnce(w.spec.ctx, w.client, w.spec.WarmupReqFunc, w.spec.ParseResFunc, nil, time.Time{})
+	case w.spec.InvokeFunc != nil:
+		_, _ = triggerInvoke(w.spec.ctx, w.spec.InvokeFunc, time.Time{})
+	default:
+		_ = w.runJourney(&w.spec.Scenarios[0], time.Time{}, false)
+	}
+}
 
-		sortedByTimestamp := SortTimestamp(benchmarks)
-		sortedByTook := SortTook(slices.Clone(benchmarks))
+// send one request (or one journey), the scenario is drawn by weight if spec.Scenarios is specified.
+//
+// Error is only returned if there are no more requests or the benchmark is interrupted.
+func (w *worker) send(intended time.Time) error {
+	if err := w.spec.ctx.Err(); err != nil {
+		return err
+	}
+	w.rec.metrics.addInFlight(1)
+	defer w.rec.metrics.addInFlight(-1)
 
-		futures := util.NewAwaitFutures[any](nil)
-		futures.SubmitAsync(func() (any, error) {
-			return nil, plotLatencyGraph(spec, sortedByTimestamp, stats)
-		})
-		futures.SubmitAsync(func() (any, error) {
-			return nil, plotSuccessRateGraph(spec, sortedByTimestamp, stats)
-		})
-		futures.SubmitAsync(func() (any, error) {
-			return nil, plotPercentileGraph(spec, sortedByTook, stats)
-		})
-		err := futures.AwaitAnyErr()
+	if w.spec.InvokeFunc != nil {
+		b, err := triggerInvoke(w.spec.ctx, w.spec.InvokeFunc, intended)
 		if err != nil {
-			return sortedByTimestamp, stats, err
+			return err
 		}
+		w.record(&b)
+		return nil
 	}
-	util.Printlnf("\n-------------------------------\n")
+	if w.spec.scenarioPicker == nil {
+		b, err := triggerOnce(w.spec.ctx, w.client, w.spec.BuildReqFunc, w.spec.ParseResFunc, w.spec.assertRes, intended)
+		if err != nil {
+			return err
+		}
+		w.record(&b)
+		return nil
+	}
+	s := w.spec.scenarioPicker.pick()
+	if len(s.Steps) > 0 {
+		return w.runJourney(s, intended, true)
+	}
+	b, err := triggerOnce(w.spec.ctx, w.client, s.BuildReqFunc, s.ParseResFunc, w.spec.assertRes, intended)
+	if err != nil {
+		return err
+	}
+	b.Scenario = s.Name
+	w.record(&b)
+	return nil
+}
 
-	return benchmarks, stats, nil
+func (w *worker) record(b *Benchmark) {
+	if w.rec.record(b) {
+		w.records = append(w.records, *b)
+	}
 }
 
 type Benchmark struct {
-	Timestamp   int64
-	Took        time.Duration
-	Success     bool
-	Extra       map[string]any
-	HttpStatus  int
-	successRate float64
+	Timestamp int64
+
+	// scheduled send time, it's the same as Timestamp unless the request is scheduled by BenchmarkSpec.Rate.
+	IntendedTimestamp int64
+
+	Took time.Duration
+
+	// latency measured from the scheduled send time (IntendedTimestamp), i.e., time spent waiting for a worker is included.
+	CorrectedTook time.Duration
+
+	// timing breakdown of the request, phases that didn't happen (e.g., connection reused) are zero.
+	DNSLookup    time.Duration
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+	TTFB         time.Duration // time to first byte, from the request is fully written until the first response byte is received
+	BodyTransfer time.Duration // from the first response byte is received until the body is fully read
+
+	Success    bool
+	Extra      map[string]any
+	HttpStatus int
+
+	// name of the Scenario, empty if BenchmarkSpec.Scenarios is not specified.
+	Scenario string
+
+	// name of the JourneyStep, empty if the Scenario is not a journey.
+	Step string
+
+	// whole journey latency, only set on the last step sent in the journey (the rest of the steps are skipped if any step fails).
+	JourneyTook time.Duration
+
+	successRate  float64
+	sentUnixNano int64 // send time in ns, unique across records, see uniqueUnixNano
 }
 
 type Result struct {
@@ -303,6 +859,11 @@ func SortTook(bench []Benchmark) []Benchmark {
 	return bench
 }
 
+func SortCorrectedTook(bench []Benchmark) []Benchmark {
+	sort.Slice(bench, func(i, j int) bool { return bench[i].CorrectedTook < bench[j].CorrectedTook })
+	return bench
+}
+
 func SortTimestamp(bench []Benchmark) []Benchmark {
 	sort.Slice(bench, func(i, j int) bool { return bench[i].Timestamp < bench[j].Timestamp })
 	return bench
@@ -324,6 +885,99 @@ type Stats struct {
 	Avg           time.Duration
 	Med           time.Duration
 	Percentiles   map[int]Percentile
+
+	// coordinated omission corrected latency (measured from the scheduled send time), only available in Rate mode.
+	Corrected *LatencyStats
+
+	// stats of each timing phase (dns_lookup, tcp_connect, tls_handshake, ttfb, body_transfer).
+	Phases map[string]LatencyStats
+
+	// non-empty output of LogStatFunc.
+	ExtraOutput []string
+
+	// results of BenchmarkSpec.Thresholds.
+	Thresholds []ThresholdResult
+
+	// stats of each scenario, only available if BenchmarkSpec.Scenarios is specified.
+	Scenarios map[string]Stats
+
+	// stats of each step, only available in stats of journey scenarios (Scenario.Steps).
+	Steps map[string]Stats
+
+	// stats of whole journeys, only available in stats of journey scenarios (Scenario.Steps).
+	Journey *JourneyStats
+
+	// stats of connections and messages, only available if BenchmarkSpec.WebSocket is specified.
+	WebSocket *WebSocketStats
+
+	// the benchmark is interrupted (e.g., the context is cancelled), stats only cover the partial results.
+	Interrupted bool
+
+	// stats of each sink, only available if BenchmarkSpec.Sinks is specified.
+	Sinks []SinkStats
+}
+
+type LatencyStats struct {
+	Count       int
+	Min         time.Duration
+	Max         time.Duration
+	Avg         time.Duration
+	Med         time.Duration
+	Percentiles map[int]time.Duration
+}
+
+// ratio of unsuccessful requests (0-1).
+func (s *Stats) ErrorRate() float64 {
+	if s.TotalRequests < 1 {
+		return 0
+	}
+	return float64(s.SuccessCount[false]) / float64(s.TotalRequests)
+}
+
+// set TotalTime and Throughput, including stats of scenarios, steps and journeys.
+func (s *Stats) setTotalTime(totalTime time.Duration) {
+	secs := float64(totalTime) / float64(time.Second)
+	s.TotalTime = totalTime
+	s.Throughput = float64(s.TotalRequests) / secs
+	if s.Journey != nil {
+		s.Journey.Throughput = float64(s.Journey.Count) / secs
+	}
+	for _, m := range []map[string]Stats{s.Scenarios, s.Steps} {
+		for k, v := range m {
+			v.setTotalTime(totalTime)
+			m[k] = v
+		}
+	}
+}
+
+func (s *Stats) latencyStats() LatencyStats {
+	ls := LatencyStats{
+		Count:       s.TotalRequests,
+		Min:         s.Min,
+		Max:         s.Max,
+		Avg:         s.Avg,
+		Med:         s.Med,
+		Percentiles: make(map[int]time.Duration, len(s.Percentiles)),
+	}
+	for k, v := range s.Percentiles {
+		ls.Percentiles[k] = v.Record.Took
+	}
+	return ls
+}
+
+func (s *LatencyStats) PercentileString() string {
+	percStr := strings.Builder{}
+	for _, pk := range percentileValues {
+		pv, ok := s.Percentiles[pk]
+		if !ok {
+			continue
+		}
+		if percStr.Len() > 0 {
+			percStr.WriteString(", ")
+		}
+		percStr.WriteString(fmt.Sprintf("P%d: %v", pk, pv))
+	}
+	return percStr.String()
 }
 
 func (s *Stats) PercentileString() string {
@@ -341,140 +995,400 @@ func (s *Stats) PercentileString() string {
 	return percStr.String()
 }
 
-func printStats(spec BenchmarkSpec, bench []Benchmark, totalTime time.Duration, logStatFunc ...LogExtraStatFunc) (Stats, error) {
-	var (
-		concurrent   = spec.Concurrent
-		round        = spec.Round
-		dur          = spec.Duration
-		sum          time.Duration
-		stats        Stats
-		statusCount  = make(map[int]int, len(bench))
-		successCount = make(map[bool]int, len(bench))
-		total        = len(bench)
-	)
-
-	SortTook(bench) // sort by duration for calculating median
-	if total > 0 {
-		if total%2 == 0 {
-			stats.Med = (bench[total/2].Took + bench[total/2-1].Took) / 2
-		} else {
-			stats.Med = bench[total/2].Took
-		}
+// compute Stats and run LogStatFunc, bench is sorted by request order once it returns.
+func buildStats(spec BenchmarkSpec, bench []Benchmark, rec *recorder, totalTime time.Duration, sinkStats []SinkStats) Stats {
+	var stats Stats
+	if rec.streaming {
+		stats = rec.stats()
+	} else {
+		stats = computeStats(spec, bench)
+	}
+	stats.Interrupted = spec.ctx.Err() != nil
+	if spec.wsCollector != nil {
+		stats.WebSocket = spec.wsCollector.build()
 	}
+	stats.Sinks = sinkStats
+	stats.setTotalTime(totalTime)
+	stats.Thresholds = EvalThresholds(spec.thresholds, stats)
 
-	for i, b := range bench {
-		if i == 0 {
-			stats.Min = b.Took
-			stats.Max = b.Took
-		} else {
-			if b.Took > stats.Max {
-				stats.Max = b.Took
-			}
-			if b.Took < stats.Min {
-				stats.Min = b.Took
+	if len(spec.LogStatFunc) > 0 {
+		if rec.streaming {
+			SortTook(bench)
+		}
+		for _, f := range spec.LogStatFunc {
+			output := f(bench)
+			if output != "" {
+				stats.ExtraOutput = append(stats.ExtraOutput, output)
 			}
 		}
-		statusCount[b.HttpStatus]++
-		successCount[b.Success]++
-		sum += b.Took
 	}
 
-	if total > 0 {
-		stats.Avg = sum / time.Duration(total)
-	}
+	// sort by request order for readability in data output file
+	SortTimestamp(bench)
+	return stats
+}
 
-	SortTook(bench)
-	stats.TotalTime = totalTime
-	stats.TotalRequests = total
-	stats.Throughput = float64(total) / (float64(totalTime) / float64(time.Second))
-	stats.StatusCount = statusCount
-	stats.SuccessCount = successCount
+// format Stats in plain text, it's printed to stdout and written at the beginning of the text data file.
+func formatStats(spec BenchmarkSpec, stats Stats) string {
+	var (
+		concurrent = spec.Concurrent
+		round      = spec.Round
+		dur        = spec.Duration
+		total      = stats.TotalRequests
+		totalTime  = stats.TotalTime
+	)
 
 	sl := util.SLPinter{}
 	sl.Printlnf("\nBenchmark Time: %v", spec.benchmarkTime)
 	sl.Printlnf("\n--------- Brief ---------------\n")
+	if stats.Interrupted {
+		sl.Printlnf("interrupted: true (partial results)")
+	}
 	sl.Printlnf("total_time: %v", totalTime)
 	sl.Printlnf("total_requests: %v", total)
 	sl.Printlnf("throughput: %.0f req/sec", stats.Throughput)
-	sl.Printlnf("concurrency: %v", concurrent)
+	if spec.Rate > 0 {
+		sl.Printlnf("rate: %v req/sec", spec.Rate)
+	}
+	if spec.Rate > 0 && spec.WebSocket == nil {
+		sl.Printlnf("max_workers: %v", spec.MaxWorkers)
+	} else {
+		sl.Printlnf("concurrency: %v", concurrent) // connections in WebSocket mode
+	}
+	if len(spec.Stages) > 0 {
+		sl.Printlnf("stages: %v", spec.Stages)
+	}
 	if dur > 0 {
 		sl.Printlnf("duration: %v", dur)
+	} else if spec.Rate > 0 {
+		sl.Printlnf("rounds (total): %v", round)
 	} else {
 		sl.Printlnf("rounds (for each worker): %v", round)
 	}
-	sl.Printlnf("status_count: %v", statusCount)
-	sl.Printlnf("success_count: %v", successCount)
+	if spec.Assert != "" {
+		sl.Printlnf("assert: %v", spec.Assert)
+	}
+	sl.Printlnf("status_count: %v", stats.StatusCount)
+	sl.Printlnf("success_count: %v", stats.SuccessCount)
 	sl.Printlnf("\n--------- Latency -------------\n")
+	if spec.StreamStats {
+		sl.Printlnf("(streaming, approximated by histogram)")
+	}
 	sl.Printlnf("min: %v", stats.Min)
 	sl.Printlnf("max: %v", stats.Max)
 	sl.Printlnf("median: %v", stats.Med)
 	sl.Printlnf("avg: %v", stats.Avg)
+	for _, pv := range percentileValues {
+		if p, ok := stats.Percentiles[pv]; ok {
+			sl.Printlnf("P%d: %v", pv, p.Record.Took)
+		}
+	}
 
-	stats.Percentiles = map[int]Percentile{}
-	if total > 0 {
-		for _, pv := range []int{75, 90, 95, 99} {
-			stats.Percentiles[pv] = percentile(bench, float64(pv))
-			sl.Printlnf("P%d: %v", pv, stats.Percentiles[pv].Record.Took)
+	if corrected := stats.Corrected; corrected != nil {
+		sl.Printlnf("\n--------- Corrected Latency ---\n")
+		sl.Printlnf("(measured from the scheduled send time)")
+		sl.Printlnf("min: %v", corrected.Min)
+		sl.Printlnf("max: %v", corrected.Max)
+		sl.Printlnf("median: %v", corrected.Med)
+		sl.Printlnf("avg: %v", corrected.Avg)
+		for _, pv := range percentileValues {
+			if v, ok := corrected.Percentiles[pv]; ok {
+				sl.Printlnf("P%d: %v", pv, v)
+			}
+		}
+	}
+
+	if slices.ContainsFunc(util.MapValues(stats.Phases), func(ps LatencyStats) bool { return ps.Count > 0 }) {
+		sl.Printlnf("\n--------- Timing Breakdown ----\n")
+		for _, p := range timingPhases {
+			ps := stats.Phases[p.Name]
+			if ps.Count < 1 {
+				sl.Printlnf("%s: -", p.Name)
+				continue
+			}
+			sl.Printlnf("%s (count: %d): min: %v, max: %v, avg: %v, %v", p.Name, ps.Count, ps.Min, ps.Max, ps.Avg, ps.PercentileString())
+		}
+	}
+
+	if len(spec.Scenarios) > 0 {
+		sl.Printlnf("\n--------- Scenarios -----------\n")
+		for _, sc := range spec.Scenarios {
+			ss := stats.Scenarios[sc.Name]
+			sl.Printlnf("%s (weight: %d): requests: %d, throughput: %.0f req/sec, error_rate: %.4f, status_count: %v",
+				sc.Name, sc.Weight, ss.TotalRequests, ss.Throughput, ss.ErrorRate(), ss.StatusCount)
+			sl.Printlnf("  latency: min: %v, max: %v, median: %v, avg: %v, %v", ss.Min, ss.Max, ss.Med, ss.Avg, ss.PercentileString())
+			if ss.Corrected != nil {
+				sl.Printlnf("  corrected_latency: min: %v, max: %v, median: %v, avg: %v, %v", ss.Corrected.Min, ss.Corrected.Max,
+					ss.Corrected.Med, ss.Corrected.Avg, ss.Corrected.PercentileString())
+			}
+			if js := ss.Journey; js != nil {
+				sl.Printlnf("  journey: count: %d, throughput: %.0f journeys/sec, success_count: %v", js.Count, js.Throughput, js.SuccessCount)
+				sl.Printlnf("  journey_latency: min: %v, max: %v, median: %v, avg: %v, %v", js.Min, js.Max, js.Med, js.Avg, js.PercentileString())
+			}
+			for _, st := range sc.Steps {
+				ps := ss.Steps[st.Name]
+				sl.Printlnf("  step %s: requests: %d, error_rate: %.4f, latency: min: %v, max: %v, median: %v, avg: %v, %v",
+					st.Name, ps.TotalRequests, ps.ErrorRate(), ps.Min, ps.Max, ps.Med, ps.Avg, ps.PercentileString())
+			}
+		}
+	}
+
+	if ws := stats.WebSocket; ws != nil {
+		sl.Printlnf("\n--------- WebSocket -----------\n")
+		sl.Printlnf("url: %v", spec.WebSocket.Url)
+		sl.Printlnf("connections: %d, failed: %d", ws.Connections, ws.FailedConnections)
+		if ws.Connect.Count > 0 {
+			sl.Printlnf("connect: min: %v, max: %v, median: %v, avg: %v, %v", ws.Connect.Min, ws.Connect.Max, ws.Connect.Med,
+				ws.Connect.Avg, ws.Connect.PercentileString())
 		}
+		sl.Printlnf("messages: sent: %d, received: %d, dropped: %d, failed: %d, unmatched: %d", ws.Sent, ws.Received, ws.Dropped,
+			ws.Failed, ws.Unmatched)
 	}
 
-	if !spec.DisableOutputFile {
+	if len(stats.Sinks) > 0 {
+		sl.Printlnf("\n--------- Sinks ---------------\n")
+		for _, s := range stats.Sinks {
+			sl.Printlnf("%s: written: %d, failed: %d, dropped: %d", s.Name, s.Written, s.Failed, s.Dropped)
+		}
+	}
+
+	if len(stats.Thresholds) > 0 {
+		sl.Printlnf("\n--------- Thresholds ----------\n")
+		for _, t := range stats.Thresholds {
+			sl.Printlnf("%v", t)
+		}
+	}
+
+	if !spec.DisableOutputFile || spec.HtmlReport || spec.SaveRunFilename != "" {
 		sl.Printlnf("\n--------- Data ----------------\n")
-		sl.Printlnf("data file: %v", spec.DataOutputFilename)
+		if !spec.DisableOutputFile {
+			sl.Printlnf("data file: %v", spec.DataOutputFilename)
+			if spec.OutputFormat == OutputFormatCsv {
+				sl.Printlnf("stats file: %v", csvStatsFilename(spec.DataOutputFilename))
+			}
+		}
+		if spec.HtmlReport {
+			sl.Printlnf("html report: %v", spec.HtmlReportFilename)
+		}
+		if spec.SaveRunFilename != "" {
+			sl.Printlnf("saved run: %v", spec.SaveRunFilename)
+		}
 		sl.WriteString("\n")
-	} else if len(logStatFunc) < 1 {
+	} else if len(spec.LogStatFunc) < 1 {
 		sl.WriteString("\n")
 	}
 
-	if len(logStatFunc) > 0 {
+	if len(spec.LogStatFunc) > 0 {
 		sl.Printlnf("\n--------- Extra ---------------\n")
-		for _, f := range logStatFunc {
-			output := f(bench)
-			if output != "" {
-				sl.Printlnf(output)
-			}
+		for _, output := range stats.ExtraOutput {
+			sl.Printlnf(output)
 		}
 		sl.WriteString("\n")
 	}
-	print(sl.String())
+	return sl.String()
+}
 
-	// sort by request order for readability in data output file
-	SortTimestamp(bench)
-	if !spec.DisableOutputFile {
-		f, err := util.ReadWriteFile(spec.DataOutputFilename)
-		if err != nil {
-			return stats, err
+// write stats and records to data output file in plain text, bench is sorted by request order.
+func writeTextDataFile(spec BenchmarkSpec, stats Stats, bench []Benchmark) error {
+	return writeFile(spec.DataOutputFilename, func(w io.Writer) error {
+		if _, err := io.WriteString(w, formatStats(spec, stats)+"\n-------------------------------\n\n"); err != nil {
+			return err
+		}
+		for _, b := range bench {
+			if _, err := io.WriteString(w, formatRecord(spec, b)); err != nil {
+				return err
+			}
 		}
-		defer f.Close()
-		_ = f.Truncate(0)
+		return nil
+	})
+}
+
+func formatRecord(spec BenchmarkSpec, b Benchmark) string {
+	timing := fmt.Sprintf("DNS: %v, Connect: %v, TLS: %v, TTFB: %v, Transfer: %v", b.DNSLookup, b.TCPConnect, b.TLSHandshake, b.TTFB, b.BodyTransfer)
+	var scenario string
+	if b.Scenario != "" {
+		scenario = "Scenario: " + b.Scenario + ", "
+	}
+	if b.Step != "" {
+		scenario += "Step: " + b.Step + ", "
+	}
+	if b.JourneyTook > 0 {
+		scenario += fmt.Sprintf("JourneyTook: %v, ", b.JourneyTook)
+	}
+	if spec.Rate > 0 {
+		return scenario + fmt.Sprintf("Timestamp: %d, IntendedTimestamp: %d, Took: %v, CorrectedTook: %v, Success: %v (%.2f%%), HttpStatus: %d, %s, Extra: %+v\n",
+			b.Timestamp, b.IntendedTimestamp, b.Took, b.CorrectedTook, b.Success, b.successRate*100, b.HttpStatus, timing, b.Extra)
+	}
+	return scenario + fmt.Sprintf("Timestamp: %d, Took: %v, Success: %v (%.2f%%), HttpStatus: %d, %s, Extra: %+v\n", b.Timestamp,
+		b.Took, b.Success, b.successRate*100, b.HttpStatus, timing, b.Extra)
+}
 
-		sl.Printlnf("-------------------------------\n\n")
-		f.WriteString(sl.String())
+// calculate stats using all the Benchmark records, bench is sorted by Took afterwards.
+func computeStats(spec BenchmarkSpec, bench []Benchmark) Stats {
+	var (
+		stats        Stats
+		statusCount  = make(map[int]int, len(bench))
+		successCount = make(map[bool]int, len(bench))
+		total        = len(bench)
+		took         = make([]time.Duration, 0, total)
+	)
+
+	SortTook(bench) // sort by duration for calculating percentiles
+	for _, b := range bench {
+		statusCount[b.HttpStatus]++
+		successCount[b.Success]++
+		took = append(took, b.Took)
+	}
+	lat := durationStats(took)
+	stats.Min, stats.Max, stats.Avg, stats.Med = lat.Min, lat.Max, lat.Avg, lat.Med
+
+	stats.TotalRequests = total
+	stats.StatusCount = statusCount
+	stats.SuccessCount = successCount
+
+	stats.Percentiles = map[int]Percentile{}
+	if total > 0 {
+		for _, pv := range percentileValues {
+			stats.Percentiles[pv] = percentile(bench, float64(pv))
+		}
+	}
+
+	stats.Phases = computePhaseStats(bench)
+
+	if spec.Rate > 0 {
+		corrected := make([]time.Duration, 0, total)
 		for _, b := range bench {
-			f.WriteString(fmt.Sprintf("Timestamp: %d, Took: %v, Success: %v (%.2f%%), HttpStatus: %d, Extra: %+v\n", b.Timestamp,
-				b.Took, b.Success, b.successRate*100, b.HttpStatus, b.Extra))
+			corrected = append(corrected, b.CorrectedTook)
 		}
+		cs := durationStats(corrected)
+		stats.Corrected = &cs
 	}
 
-	return stats, nil
+	if len(spec.Scenarios) > 0 {
+		stats.Scenarios = computeScenarioStats(spec, bench)
+	}
+	return stats
 }
 
-func triggerOnce(client *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFunc) Benchmark {
-	timestamp := time.Now().UnixMicro()
+// calculate stats of the durations, vals is sorted afterwards.
+func durationStats(vals []time.Duration) LatencyStats {
+	st := LatencyStats{Count: len(vals), Percentiles: map[int]time.Duration{}}
+	total := len(vals)
+	if total < 1 {
+		return st
+	}
+
+	slices.Sort(vals)
+	st.Min = vals[0]
+	st.Max = vals[total-1]
+	if total%2 == 0 {
+		st.Med = (vals[total/2] + vals[total/2-1]) / 2
+	} else {
+		st.Med = vals[total/2]
+	}
+
+	var sum time.Duration
+	for _, v := range vals {
+		sum += v
+	}
+	st.Avg = sum / time.Duration(total)
+
+	for _, pv := range percentileValues {
+		st.Percentiles[pv] = vals[percentileIndex(total, float64(pv))]
+	}
+	return st
+}
+
+// send time of a request in ns, it's strictly increasing across the workers (t is moved forward by a few ns if necessary),
+// so that records never share the same send time, e.g., points written to InfluxDB are identified by timestamp.
+func uniqueUnixNano(t time.Time) int64 {
+	ns := t.UnixNano()
+	for {
+		last := lastSendUnixNano.Load()
+		if ns <= last {
+			ns = last + 1
+		}
+		if lastSendUnixNano.CompareAndSwap(last, ns) {
+			return ns
+		}
+	}
+}
+
+// send request and measure the latency, intended is the scheduled send time, zero value means the request is sent immediately.
+//
+// ctx.Err() is returned if the request is failed because ctx is done, the result should be discarded.
+func triggerOnce(ctx context.Context, client *http.Client, buildReq BuildRequestFunc, parseRes ParseResponseFunc, afterRes afterResponseFunc, intended time.Time) (Benchmark, error) {
 	start := time.Now()
-	r, end := doSend(client, buildReq, parseRes)
+	sent := uniqueUnixNano(start)
+	if intended.IsZero() || intended.After(start) {
+		intended = start
+	}
+	timing := &httpTiming{}
+	r, end, err := doSend(ctx, client, buildReq, parseRes, afterRes, timing)
+	if err != nil {
+		return Benchmark{}, err
+	}
+	if !r.Success && ctx.Err() != nil {
+		return Benchmark{}, ctx.Err()
+	}
 	took := end.Sub(start)
 	bench := Benchmark{
-		Timestamp:  timestamp,
-		Took:       took,
-		Success:    r.Success,
-		Extra:      r.Extra,
-		HttpStatus: r.HttpStatus,
+		Timestamp:         sent / int64(time.Microsecond),
+		IntendedTimestamp: intended.UnixMicro(),
+		Took:              took,
+		CorrectedTook:     end.Sub(intended),
+		Success:           r.Success,
+		Extra:             r.Extra,
+		HttpStatus:        r.HttpStatus,
+		sentUnixNano:      sent,
 	}
-	return bench
+	timing.fill(&bench, end)
+	return bench, nil
+}
+
+// invoke and measure the latency, intended is the scheduled send time, zero value means the request is sent immediately.
+//
+// ctx.Err() is returned if the invocation is failed and ctx is done, the result should be discarded.
+func triggerInvoke(ctx context.Context, invoke InvokeFunc, intended time.Time) (Benchmark, error) {
+	start := time.Now()
+	sent := uniqueUnixNano(start)
+	if intended.IsZero() || intended.After(start) {
+		intended = start
+	}
+	r, err := invoke(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNoMoreRequests) {
+			return Benchmark{}, err
+		}
+		r = Result{HttpStatus: r.HttpStatus, Success: false, Extra: map[string]any{"ERROR": err.Error()}}
+	}
+	if !r.Success && ctx.Err() != nil {
+		return Benchmark{}, ctx.Err()
+	}
+	end := time.Now()
+	return Benchmark{
+		Timestamp:         sent / int64(time.Microsecond),
+		IntendedTimestamp: intended.UnixMicro(),
+		Took:              end.Sub(start),
+		CorrectedTook:     end.Sub(intended),
+		Success:           r.Success,
+		Extra:             r.Extra,
+		HttpStatus:        r.HttpStatus,
+		sentUnixNano:      sent,
+	}, nil
+}
+
+// extra line drawn on the latency graph, e.g., corrected latency or latency of a scenario.
+type plotLine struct {
+	Name string
+	XYs  plotter.XYs
 }
 
-func plotGraph(spec BenchmarkSpec, bench []Benchmark, stat Stats, title string, xlabel string, fname string, drawPercentile bool) error {
+// plot request latency, lines are the extra lines drawn on the graph, they are optional.
+func plotGraph(spec BenchmarkSpec, bench []Benchmark, lines []plotLine, stat Stats, title string, xlabel string, fname string, drawPercentile bool) error {
+	if stat.Interrupted {
+		title += " (Interrupted, Partial Results)"
+	}
 	p := plot.New()
 	p.Title.Text = "\n" + title
 	p.Title.Padding = 0.1 * vg.Inch
@@ -491,7 +1405,19 @@ func plotGraph(spec BenchmarkSpec, bench []Benchmark, stat Stats, title string,
 	}
 	p.Y.Max = float64(stat.Max.Milliseconds()) + 1
 	data := toXYs(bench)
-	err := plotutil.AddLinePoints(p, data)
+	var err error
+	if stat.Corrected != nil {
+		p.Y.Max = float64(max(stat.Max, stat.Corrected.Max).Milliseconds()) + 1
+	}
+	if len(lines) > 0 {
+		vs := []any{"Latency", data}
+		for _, l := range lines {
+			vs = append(vs, l.Name, l.XYs)
+		}
+		err = plotutil.AddLinePoints(p, vs...)
+	} else {
+		err = plotutil.AddLinePoints(p, data)
+	}
 	if err != nil {
 		return err
 	}
@@ -528,7 +1454,12 @@ func plotPercentileGraph(spec BenchmarkSpec, bench []Benchmark, stats Stats) err
 	// SortTook(bench)
 	titleStats := fmt.Sprintf("(Total %d Requests, Concurrency: %v, Max: %v, Min: %v, Avg: %v, Median: %v, %v)",
 		len(bench), spec.Concurrent, stats.Max, stats.Min, stats.Avg, stats.Med, stats.PercentileString())
-	err := plotGraph(spec, bench, stats, spec.benchmarkTime+" - Latency Percentile Plot "+titleStats,
+	var lines []plotLine
+	if stats.Corrected != nil {
+		lines = append(lines, plotLine{"Corrected Latency", toCorrectedXYs(SortCorrectedTook(slices.Clone(bench)))})
+	}
+	lines = append(lines, scenarioPlotLines(spec, bench, true)...)
+	err := plotGraph(spec, bench, lines, stats, spec.benchmarkTime+" - Latency Percentile Plot "+titleStats,
 		"X - Sorted By Latency", spec.PlotSortedByLatencyFilename, true)
 	if err != nil {
 		return err
@@ -541,7 +1472,12 @@ func plotLatencyGraph(spec BenchmarkSpec, bench []Benchmark, stats Stats) error
 	// SortTimestamp(bench)
 	titleStats := fmt.Sprintf("(Total %d Requests, Concurrency: %v, Max: %v, Min: %v, Avg: %v, Median: %v, %v)",
 		len(bench), spec.Concurrent, stats.Max, stats.Min, stats.Avg, stats.Med, stats.PercentileString())
-	err := plotGraph(spec, bench, stats, spec.benchmarkTime+" - Request Latency Plot "+titleStats,
+	var lines []plotLine
+	if stats.Corrected != nil {
+		lines = append(lines, plotLine{"Corrected Latency", toCorrectedXYs(bench)})
+	}
+	lines = append(lines, scenarioPlotLines(spec, bench, false)...)
+	err := plotGraph(spec, bench, lines, stats, spec.benchmarkTime+" - Request Latency Plot "+titleStats,
 		"X - Sorted By Request Timestamp", spec.PlotSortedByRequestOrderFilename, false)
 	if err != nil {
 		return err
@@ -555,6 +1491,9 @@ func plotSuccessRateGraph(spec BenchmarkSpec, bench []Benchmark, stats Stats) er
 	titleStats := fmt.Sprintf("(Total %d Requests, Concurrency: %v, Max: %v, Min: %v, Avg: %v, Median: %v, %v)",
 		len(bench), spec.Concurrent, stats.Max, stats.Min, stats.Avg, stats.Med, stats.PercentileString())
 	title := spec.benchmarkTime + " - Success Rate Plot " + titleStats
+	if stats.Interrupted {
+		title += " (Interrupted, Partial Results)"
+	}
 	xlabel := "X - Sorted By Request Timestamp"
 	fname := spec.PlotSuccessRateFilename
 
@@ -589,6 +1528,42 @@ func toXYs(bench []Benchmark) plotter.XYs {
 	return pts
 }
 
+func toCorrectedXYs(bench []Benchmark) plotter.XYs {
+	pts := make(plotter.XYs, 0, len(bench))
+	for i := range bench {
+		pts = append(pts, plotter.XY{
+			X: float64(i),
+			Y: float64(bench[i].CorrectedTook.Milliseconds()),
+		})
+	}
+	return pts
+}
+
+// latency lines of each scenario, x is the index of the record in bench.
+//
+// If scaleX is true (bench is sorted by latency), x is stretched to align the percentiles of the scenario with the aggregate ones.
+func scenarioPlotLines(spec BenchmarkSpec, bench []Benchmark, scaleX bool) []plotLine {
+	lines := make([]plotLine, 0, len(spec.Scenarios))
+	for _, sc := range spec.Scenarios {
+		pts := plotter.XYs{}
+		for i := range bench {
+			if bench[i].Scenario == sc.Name {
+				pts = append(pts, plotter.XY{X: float64(i), Y: float64(bench[i].Took.Milliseconds())})
+			}
+		}
+		if len(pts) < 1 {
+			continue
+		}
+		if scaleX && len(pts) > 1 {
+			for j := range pts {
+				pts[j].X = float64(j) * float64(len(bench)-1) / float64(len(pts)-1)
+			}
+		}
+		lines = append(lines, plotLine{"Latency [" + sc.Name + "]", pts})
+	}
+	return lines
+}
+
 func toSuccessRateXYs(bench []Benchmark) plotter.XYs {
 	pts := make(plotter.XYs, 0, len(bench))
 	for i := range bench {
@@ -601,11 +1576,16 @@ func toSuccessRateXYs(bench []Benchmark) plotter.XYs {
 }
 
 func percentile(bench []Benchmark, percentile float64) Percentile {
-	idx := math.Ceil(percentile / 100.0 * float64(len(bench)))
-	i := int(idx) - 1
+	i := percentileIndex(len(bench), percentile)
 	return Percentile{Record: bench[i], Index: i}
 }
 
+// index of the percentile value in n sorted values.
+func percentileIndex(n int, percentile float64) int {
+	idx := math.Ceil(percentile / 100.0 * float64(n))
+	return max(int(idx)-1, 0)
+}
+
 func drawPercentileLine(p *plot.Plot, index int, label string, color int) {
 	xys := make(plotter.XYs, 2)
 	xys[0] = plotter.XY{X: float64(index), Y: 0}
@@ -695,9 +1675,37 @@ func newClient() *http.Client {
 var (
 	debug     = flags.Bool("debug", false, "Enable debug log", false)
 	conc      = flags.Int("conc", 1, "Concurrency", false)
-	concGroup = flags.String("concgroup", "", "Concurrency Groups (e.g., '1,30,50', is equivalent to running the benchmark three times with concurrency 1, 30 and 50)", false)
+	concGroup = flags.String("concgroup", "", "Concurrency Groups (e.g., '1,30,50', is equivalent to running the benchmark three times with concurrency 1, 30 and 50), followed by a summary table and plots of throughput and latency vs concurrency", false)
 	round     = flags.Int("round", 2, "Round", false)
 	duration  = flags.Duration("dur", 0, "Duration", false)
+	stages    = flags.String("stages", "", "Staged load profile (e.g., '10s:50,1m:50,10s:0', is equivalent to ramping up to 50 workers in 10s, holding 50 workers for 1m and ramping down to 0 in 10s), -conc and -dur are ignored", false)
+	stageRate = flags.Bool("stagerate", false, "Stage targets in -stages are arrival rates (req/sec) instead of number of workers", false)
+	rate      = flags.Float64("rate", 0, "Constant arrival rate (req/sec), requests are sent on a fixed timeline regardless of response time, -conc becomes the min number of workers and -round becomes the total number of requests", false)
+
+	streamStats = flags.Bool("stream", false, "Compute statistics with bounded memory (HDR-style histogram), records are only retained when plots, data file, html report or -save are enabled", false)
+	noPlot      = flags.Bool("noplot", false, "Disable plot graphs", false)
+	plotSplit   = flags.String("plotsplit", "", "Split latency histogram and cdf plots by 'status' or 'success'", false)
+	plotBucket  = flags.Duration("plotbucket", defPlotBucketWidth, "Width of the time buckets of throughput, latency percentiles and error rate over time plots", false)
+	noDataFile  = flags.Bool("nodata", false, "Disable data output file", false)
+	outFormat   = flags.String("out-format", OutputFormatText, "Format of data output file: text, json, csv or ndjson", false)
+	htmlFlag    = flags.Bool("html", false, "Generate self-contained html report (benchmark_report.html)", false)
+	saveRun     = flags.String("save", "", "Save stats and latency samples of the run to the file (json), that can be compared with other runs using -compare", false)
+	metricsAddr = flags.String("metrics-addr", "", "Address of the embedded http endpoint (e.g., ':9100') that exposes live metrics in Prometheus exposition format at /metrics", false)
+	metricsLing = flags.Duration("metrics-linger", DefaultMetricsLinger, "How long the -metrics-addr endpoint keeps serving after the benchmark so that the final values are scraped, it should be at least one scrape interval, a negative value stops serving immediately", false)
+	influxUrl   = flags.String("influx-url", "", "InfluxDB write endpoint (precision must be ns), records are streamed as points in line protocol.\nE.g., http://localhost:8086/api/v2/write?org=myorg&bucket=mybucket&precision=ns\n", false)
+	influxToken = flags.String("influx-token", "", "InfluxDB api token", false)
+	otlpUrl     = flags.String("otlp-url", "", "OTLP/HTTP metrics endpoint of OpenTelemetry collector, request counters and latency histograms are exported periodically.\nE.g., http://localhost:4318/v1/metrics\n", false)
+	progressInt = flags.Duration("progress", time.Second, "Interval of live progress (elapsed/remaining time, rps, rolling p50/p99, error rate and status code counts), 0 to disable, it's disabled if stdout is not a terminal", false)
+	assertFlag  = flags.String("assert", "", "Assertion expr evaluated against the http response, the request is unsuccessful if it's false (non-200 responses are always unsuccessful), env includes status, body (decoded json) and headers (names are in lowercase).\nE.g., body.error == false && len(body.data) > 0\n", false)
+	thresholds  = flags.StrSlice("threshold", "Threshold (SLO) evaluated after the benchmark, can be repeated (e.g., 'p99 < 200ms', 'error_rate < 0.01', 'throughput > 500'), exits with code 99 if any threshold is breached", false)
+
+	search        = flags.String("search", "", "Search for the max sustainable load by increasing concurrency ('conc') or arrival rate ('rate') step by step, until throughput plateaus or SLO is breached, 'rate' requires -dur", false)
+	searchStart   = flags.Int("searchstart", 1, "Initial load of -search", false)
+	searchStep    = flags.Int("searchstep", 0, "Load increased in each step of -search (default -searchstart)", false)
+	searchMax     = flags.Int("searchmax", 0, "Max load of -search (default 20 steps)", false)
+	searchPlateau = flags.Float64("searchplateau", DefaultSaturationPlateauThreshold, "Min relative throughput gain between steps of -search, in rate mode, it's the max ratio that throughput can fall behind the arrival rate", false)
+	searchP99     = flags.Duration("searchp99", 0, "P99 latency SLO of -search", false)
+	searchErrRate = flags.Float64("searcherr", 0, "Error rate SLO (0-1) of -search, e.g., 0.01", false)
 )
 
 type CliBenchmarkResult struct {
@@ -715,24 +1723,77 @@ func StartBenchmarkCmd() ([]CliBenchmarkResult, error) {
 
 	// cmd flags
 	var (
-		url        = flags.String("url", "", "URL", true)
-		method     = flags.String("method", "GET", "HTTP Method", false)
-		jsonFlag   = flags.String("json", "", "Json Body Expression. Objects created by expr is serialized as Json. \nE.g., { \"orderId\": randId(), \"type\": randPick([\"1\",\"2\",\"3\"]), \"amt\": randAmt() }\n", false)
-		headerFlag = flags.String("header", "", "HTTP Header Expression. Expression should return map[string]string object.\nE.g., { \"req-id\": randId() }\n", false)
+		url          = flags.String("url", "", "URL, required unless -requests or -journey is specified.\nFor gRPC, use grpc://host:port/package.Service/Method (or grpcs:// for TLS), -json builds the request message and -header builds the metadata.\nFor WebSocket, use ws://host:port/path (or wss:// for TLS), -conc connections are opened, -json builds each message and -header builds the handshake headers\n", false)
+		method       = flags.String("method", "GET", "HTTP Method", false)
+		jsonFlag     = flags.String("json", "", "Json Body Expression. Objects created by expr is serialized as Json. \nE.g., { \"orderId\": randId(), \"type\": randPick([\"1\",\"2\",\"3\"]), \"amt\": randAmt() }\n", false)
+		headerFlag   = flags.String("header", "", "HTTP Header Expression. Expression should return map[string]string object.\nE.g., { \"req-id\": randId() }\n", false)
+		requestsFile = flags.String("requests", "", "Replay requests from jsonl file, each line describes method, url, headers and body (optionally expr templates), -url, -method, -json and -header are ignored.\nE.g., {\"method\": \"POST\", \"url\": \"http://localhost:8080/order\", \"headers\": {\"x-token\": \"abc\"}, \"body\": {\"orderId\": \"123\"}}\n", false)
+		requestOrder = flags.String("requestorder", ReplayOrderSeq, "Order of requests in -requests: seq (each request is sent once, by default -round is adjusted to send all of them), random or roundrobin", false)
+		grpcConns    = flags.Int("grpcconns", 1, "Number of gRPC connections, calls are spread over the connections in round-robin, increase it if calls are queued by the stream limit of a single connection", false)
+		protoset     = flags.String("protoset", "", "Descriptor set file of the gRPC service (protoc --include_imports --descriptor_set_out=...), server reflection is used if it's not specified", false)
+		wsCorrField  = flags.String("wscorrelation", "", "Json path of the field used to match WebSocket replies with messages (e.g., 'id'), by default replies are matched in the order the messages are sent, it's required with -rate", false)
+		wsTimeout    = flags.Duration("wsreplytimeout", defWsReplyTimeout, "Max time waiting for the WebSocket reply, the message is dropped if it's exceeded", false)
+		wsHsTimeout  = flags.Duration("wshandshaketimeout", defWsHandshakeTimeout, "Max time of the WebSocket handshake, the connection fails if it's exceeded", false)
+		compareRuns  = flags.String("compare", "", "Compare two runs saved by -save (e.g., 'baseline.json,current.json') instead of running the benchmark, exits with code 98 if regression is detected", false)
+		tolerance    = flags.Float64("tolerance", DefaultCompareTolerance, "Max relative degradation of throughput and latency of -compare that is not a regression, e.g., 0.05 (5%)", false)
+		alpha        = flags.Float64("alpha", DefaultCompareAlpha, "Significance level of the Mann-Whitney U test on latency of -compare", false)
+		journeys     = flags.StrSlice("journey", "Multi-step user journey file (json), can be repeated for a weighted mix of journeys, each round sends all the steps in order, -url, -method, -json and -header are ignored.\nSteps may extract values from responses (json path, header or regex), expr templates of later steps reference them via 'vars'.\nE.g., {\"name\": \"order\", \"steps\": [{\"name\": \"login\", \"method\": \"POST\", \"url\": \"http://localhost:8080/login\", \"extract\": [{\"var\": \"token\", \"from\": \"json\", \"path\": \"data.token\"}]}, {\"name\": \"fetch\", \"url_expr\": \"'http://localhost:8080/order?token=' + vars.token\"}]}\n", false)
 	)
 	flags.WithExtra("Expression supports following builtin funcs:\n\trandId(), randStr(int), randPick([]any), randAmt()\n\nSee: https://expr-lang.org/docs/language-definition")
 	flags.Parse()
 
+	if *compareRuns != "" {
+		files := strings.Split(*compareRuns, ",")
+		if len(files) != 2 || util.IsBlankStr(files[0]) || util.IsBlankStr(files[1]) {
+			return nil, errs.NewErrf("Invalid -compare '%v', must be two files separated by comma, e.g., 'baseline.json,current.json'", *compareRuns)
+		}
+		_, err := CompareRunFiles(strings.TrimSpace(files[0]), strings.TrimSpace(files[1]), CompareSpec{Tolerance: *tolerance, Alpha: *alpha})
+		return nil, err
+	}
+
+	if len(*journeys) > 0 {
+		if *requestsFile != "" {
+			return nil, errs.NewErrf("-journey and -requests are mutually exclusive")
+		}
+		for _, f := range *journeys {
+			s, err := LoadJourney(f)
+			if err != nil {
+				return nil, err
+			}
+			spec.Scenarios = append(spec.Scenarios, s)
+		}
+		return doBenchmarkCli(spec)
+	}
+
+	if *requestsFile != "" {
+		requests, err := LoadReplayRequests(*requestsFile)
+		if err != nil {
+			return nil, err
+		}
+		order := strings.ToLower(strings.TrimSpace(*requestOrder))
+		rp, err := NewReplayer(requests, order)
+		if err != nil {
+			return nil, err
+		}
+		spec.BuildReqFunc = rp.BuildRequest
+		spec.DisableWarmup = true
+		spec.Reporters = append(spec.Reporters, rp) // rewind at the start of each run
+		if (order == "" || order == ReplayOrderSeq) && !isFlagSet("round") {
+			// send all the requests once
+			if *rate > 0 {
+				*round = rp.Len()
+			} else {
+				*round = int(math.Ceil(float64(rp.Len()) / float64(max(*conc, 1))))
+			}
+		}
+		return doBenchmarkCli(spec)
+	}
+
 	if *url == "" {
 		return nil, errs.NewErrf("Url is empty")
 	}
 
-	exprEnv := map[string]any{
-		"randId":   RandId,
-		"randStr":  RandStr,
-		"randPick": RandPick,
-		"randAmt":  RandAmt,
-	}
+	exprEnv := builtinExprEnv()
 	var bodyExpr *expr.Expr[map[string]any] = nil
 	if *jsonFlag != "" {
 		bodyExpr = expr.MustCompileEnv[map[string]any](*jsonFlag, exprEnv)
@@ -742,6 +1803,31 @@ func StartBenchmarkCmd() ([]CliBenchmarkResult, error) {
 		headerExpr = expr.MustCompileEnv[map[string]any](*headerFlag, exprEnv)
 	}
 
+	if strings.HasPrefix(*url, "grpc://") || strings.HasPrefix(*url, "grpcs://") {
+		if *assertFlag != "" {
+			return nil, errs.NewErrf("-assert is not supported for gRPC")
+		}
+		g, err := newCliGrpcInvoker(*url, *protoset, *grpcConns, bodyExpr, headerExpr, exprEnv)
+		if err != nil {
+			return nil, err
+		}
+		defer g.Close()
+		spec.InvokeFunc = g.Invoke
+		return doBenchmarkCli(spec)
+	}
+
+	if strings.HasPrefix(*url, "ws://") || strings.HasPrefix(*url, "wss://") {
+		ws, err := newCliWebSocketSpec(*url, bodyExpr, headerExpr, exprEnv)
+		if err != nil {
+			return nil, err
+		}
+		ws.CorrelationField = *wsCorrField
+		ws.ReplyTimeout = *wsTimeout
+		ws.HandshakeTimeout = *wsHsTimeout
+		spec.WebSocket = ws
+		return doBenchmarkCli(spec)
+	}
+
 	*method = strings.ToUpper(*method)
 	spec.BuildReqFunc = func() (*http.Request, error) {
 		var (
@@ -778,15 +1864,7 @@ func StartBenchmarkCmd() ([]CliBenchmarkResult, error) {
 			if err != nil {
 				return nil, err
 			}
-			rv := reflect.ValueOf(hv)
-			if rv.Kind() == reflect.Map {
-				it := rv.MapRange()
-				for it.Next() {
-					k := cast.ToString(it.Key().Interface())
-					v := cast.ToString(it.Value().Interface())
-					req.Header.Add(k, v)
-				}
-			}
+			addHeaders(req, hv)
 		}
 
 		return req, nil
@@ -794,24 +1872,176 @@ func StartBenchmarkCmd() ([]CliBenchmarkResult, error) {
 	return doBenchmarkCli(spec)
 }
 
+// env of expr, including the builtin funcs.
+func builtinExprEnv() map[string]any {
+	return map[string]any{
+		"randId":   RandId,
+		"randStr":  RandStr,
+		"randPick": RandPick,
+		"randAmt":  RandAmt,
+	}
+}
+
+// add headers to the request, hv should be a map (e.g., evaluated by the header expr).
+func addHeaders(req *http.Request, hv any) {
+	rv := reflect.ValueOf(hv)
+	if rv.Kind() == reflect.Map {
+		it := rv.MapRange()
+		for it.Next() {
+			k := cast.ToString(it.Key().Interface())
+			v := cast.ToString(it.Value().Interface())
+			req.Header.Add(k, v)
+		}
+	}
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func doBenchmarkCli(spec BenchmarkSpec) ([]CliBenchmarkResult, error) {
 	spec.Concurrent = *conc
 	spec.Round = *round
 	spec.Duration = *duration
+	spec.Rate = *rate
 	spec.DebugLog = *debug
+	spec.StreamStats = spec.StreamStats || *streamStats
+	spec.DisablePlotGraphs = spec.DisablePlotGraphs || *noPlot
+	if spec.PlotBucketWidth == 0 {
+		spec.PlotBucketWidth = *plotBucket
+	}
+	if spec.PlotSplitBy == "" {
+		spec.PlotSplitBy = strings.ToLower(strings.TrimSpace(*plotSplit))
+	}
+	spec.DisableOutputFile = spec.DisableOutputFile || *noDataFile
+	spec.HtmlReport = spec.HtmlReport || *htmlFlag
+	if spec.SaveRunFilename == "" {
+		spec.SaveRunFilename = *saveRun
+	}
+	if spec.MetricsAddr == "" {
+		spec.MetricsAddr = *metricsAddr
+	}
+	if spec.MetricsLinger == 0 {
+		spec.MetricsLinger = *metricsLing
+	}
+	if *influxUrl != "" {
+		s, err := NewInfluxSink(InfluxSinkSpec{Url: *influxUrl, Token: *influxToken})
+		if err != nil {
+			return nil, err
+		}
+		spec.Sinks = append(spec.Sinks, s)
+	}
+	if *otlpUrl != "" {
+		s, err := NewOtlpSink(OtlpSinkSpec{Url: *otlpUrl})
+		if err != nil {
+			return nil, err
+		}
+		spec.Sinks = append(spec.Sinks, s)
+	}
+	if spec.ProgressInterval == 0 && isTerminal(os.Stdout) {
+		spec.ProgressInterval = *progressInt
+	}
+	if spec.Assert == "" {
+		spec.Assert = *assertFlag
+	}
+	spec.Thresholds = append(spec.Thresholds, []string(*thresholds)...)
+	if spec.OutputFormat == "" {
+		spec.OutputFormat = strings.ToLower(strings.TrimSpace(*outFormat))
+	}
+
+	if !util.IsBlankStr(*stages) {
+		st, err := ParseStages(*stages)
+		if err != nil {
+			return nil, err
+		}
+		spec.Stages = st
+		spec.StageByRate = *stageRate
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if !util.IsBlankStr(*search) {
+		return doSaturationCli(ctx, spec)
+	}
 
 	if util.IsBlankStr(*concGroup) {
-		res := make([]CliBenchmarkResult, 1)
-		b, s, err := StartBenchmark(spec)
-		res = append(res, CliBenchmarkResult{
+		b, s, err := StartBenchmarkContext(ctx, spec)
+		return []CliBenchmarkResult{{
 			Benchmarks: b,
 			Stats:      s,
+		}}, err
+	}
+
+	groups, err := StartConcGroupBenchmarkContext(ctx, spec, ParseConcGroups(*concGroup))
+	res := make([]CliBenchmarkResult, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, CliBenchmarkResult{
+			Benchmarks: g.Benchmarks,
+			Stats:      g.Stats,
 		})
-		return res, err
 	}
+	return res, err
+}
+
+func doSaturationCli(ctx context.Context, spec BenchmarkSpec) ([]CliBenchmarkResult, error) {
+	ss := SaturationSpec{
+		Start:            *searchStart,
+		Step:             *searchStep,
+		Max:              *searchMax,
+		PlateauThreshold: *searchPlateau,
+		MaxP99:           *searchP99,
+		MaxErrorRate:     *searchErrRate,
+	}
+	switch strings.ToLower(strings.TrimSpace(*search)) {
+	case "conc":
+	case "rate":
+		ss.ByRate = true
+	default:
+		return nil, errs.NewErrf("Invalid search mode '%v', must be 'conc' or 'rate'", *search)
+	}
+
+	sr, err := FindSaturationContext(ctx, spec, ss)
+	res := make([]CliBenchmarkResult, 0, len(sr.Steps))
+	for _, s := range sr.Steps {
+		res = append(res, CliBenchmarkResult{
+			Benchmarks: s.Benchmarks,
+			Stats:      s.Stats,
+		})
+	}
+	return res, err
+}
 
-	tok := strings.Split(*concGroup, ",")
+// context cancelled on SIGINT or SIGTERM, the signals are restored once it's cancelled, i.e., a second Ctrl-C exits immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			select {
+			case <-done: // cancelled by the caller
+			default:
+				util.Printlnf("\nInterrupted, stopping workers and reporting partial results (press Ctrl-C again to exit immediately)")
+			}
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		stop()
+	}
+}
 
+// copy spec with prefix added to all output filenames.
+func withFilePrefix(spec BenchmarkSpec, prefix string) BenchmarkSpec {
 	if spec.PlotSortedByRequestOrderFilename == "" {
 		spec.PlotSortedByRequestOrderFilename = defPlotSortedByRequestOrderFilename
 	}
@@ -821,37 +2051,41 @@ func doBenchmarkCli(spec BenchmarkSpec) ([]CliBenchmarkResult, error) {
 	if spec.PlotSuccessRateFilename == "" {
 		spec.PlotSuccessRateFilename = defPlotSuccessRateFilename
 	}
+	if spec.PlotThroughputFilename == "" {
+		spec.PlotThroughputFilename = defPlotThroughputFilename
+	}
+	if spec.PlotLatencyOverTimeFilename == "" {
+		spec.PlotLatencyOverTimeFilename = defPlotLatencyOverTimeFilename
+	}
+	if spec.PlotErrorRateFilename == "" {
+		spec.PlotErrorRateFilename = defPlotErrorRateFilename
+	}
+	if spec.PlotHistogramFilename == "" {
+		spec.PlotHistogramFilename = defPlotHistogramFilename
+	}
+	if spec.PlotCdfFilename == "" {
+		spec.PlotCdfFilename = defPlotCdfFilename
+	}
 	if spec.DataOutputFilename == "" {
-		spec.DataOutputFilename = defDataOutputFilename
+		spec.DataOutputFilename = defaultDataOutputFilename(spec.OutputFormat)
 	}
-
-	res := make([]CliBenchmarkResult, len(*concGroup))
-	for _, t := range tok {
-		if util.IsBlankStr(t) {
-			continue
-		}
-		c := cast.ToInt(t)
-		if c < 1 {
-			continue
-		}
-		cp := spec        // this is a value copy
-		cp.Concurrent = c // change concurrency value
-		cs := cast.ToString(c)
-		cp.PlotSortedByRequestOrderFilename = "conc" + cs + "_" + cp.PlotSortedByRequestOrderFilename
-		cp.PlotSortedByLatencyFilename = "conc" + cs + "_" + cp.PlotSortedByLatencyFilename
-		cp.PlotSuccessRateFilename = "conc" + cs + "_" + cp.PlotSuccessRateFilename
-		cp.DataOutputFilename = "conc" + cs + "_" + cp.DataOutputFilename
-
-		b, s, err := StartBenchmark(cp)
-		res = append(res, CliBenchmarkResult{
-			Benchmarks: b,
-			Stats:      s,
-		})
-		if err != nil {
-			return res, err
-		}
+	if spec.HtmlReportFilename == "" {
+		spec.HtmlReportFilename = defHtmlReportFilename
+	}
+	spec.PlotSortedByRequestOrderFilename = prefix + spec.PlotSortedByRequestOrderFilename
+	spec.PlotSortedByLatencyFilename = prefix + spec.PlotSortedByLatencyFilename
+	spec.PlotSuccessRateFilename = prefix + spec.PlotSuccessRateFilename
+	spec.PlotThroughputFilename = prefix + spec.PlotThroughputFilename
+	spec.PlotLatencyOverTimeFilename = prefix + spec.PlotLatencyOverTimeFilename
+	spec.PlotErrorRateFilename = prefix + spec.PlotErrorRateFilename
+	spec.PlotHistogramFilename = prefix + spec.PlotHistogramFilename
+	spec.PlotCdfFilename = prefix + spec.PlotCdfFilename
+	spec.DataOutputFilename = prefix + spec.DataOutputFilename
+	spec.HtmlReportFilename = prefix + spec.HtmlReportFilename
+	if spec.SaveRunFilename != "" {
+		spec.SaveRunFilename = prefix + spec.SaveRunFilename
 	}
-	return res, nil
+	return spec
 }
 
 func RandId() string {
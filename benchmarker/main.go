@@ -1,12 +1,28 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/curtisnewbie/benchmarker"
 )
 
 func main() {
 	_, err := benchmarker.StartBenchmarkCmd()
 	if err != nil {
+		if errors.Is(err, benchmarker.ErrThresholdBreached) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(benchmarker.ExitCodeThresholdBreached)
+		}
+		if errors.Is(err, benchmarker.ErrRegression) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(benchmarker.ExitCodeRegression)
+		}
+		if errors.Is(err, benchmarker.ErrInterrupted) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(benchmarker.ExitCodeInterrupted)
+		}
 		panic(err)
 	}
 }
@@ -0,0 +1,306 @@
+package benchmarker
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	// exit code of benchmarker CLI when regression is detected by -compare.
+	ExitCodeRegression = 98
+
+	DefaultCompareTolerance = 0.05
+	DefaultCompareAlpha     = 0.05
+
+	// version of the saved run schema, it's only changed when the existing fields are changed or removed.
+	SavedRunSchemaVersion = 1
+
+	savedRunMaxSamples = 100_000 // max number of latency samples in saved run
+)
+
+var (
+	ErrRegression = errs.NewErrf("Performance regression detected").WithCode("REGRESSION")
+)
+
+// Saved run, i.e., stats and latency samples of a benchmark, that can be compared with other runs using CompareRuns.
+type SavedRun struct {
+	SchemaVersion int         `json:"schema_version"`
+	Stats         ExportStats `json:"stats"`
+
+	// sorted latency of requests, evenly downsampled to at most 100k samples, used for significance test.
+	LatencyNs []int64 `json:"latency_ns"`
+}
+
+// Save stats and latency samples of the run to file (json).
+func SaveRun(name string, spec BenchmarkSpec, stats Stats, bench []Benchmark) error {
+	run := SavedRun{SchemaVersion: SavedRunSchemaVersion, Stats: NewExportStats(spec, stats), LatencyNs: make([]int64, 0, len(bench))}
+	for _, b := range bench {
+		run.LatencyNs = append(run.LatencyNs, int64(b.Took))
+	}
+	slices.Sort(run.LatencyNs)
+	run.LatencyNs = pickEvenly(run.LatencyNs, savedRunMaxSamples)
+
+	return writeFile(name, func(w io.Writer) error {
+		return json.EncodeJson(w, run)
+	})
+}
+
+// Load run saved by SaveRun or BenchmarkSpec.SaveRunFilename.
+func LoadRun(name string) (SavedRun, error) {
+	var run SavedRun
+	buf, err := util.ReadFileAll(name)
+	if err != nil {
+		return run, errs.WrapErrf(err, "failed to read saved run '%v'", name)
+	}
+	if err := json.ParseJson(buf, &run); err != nil {
+		return run, errs.WrapErrf(err, "failed to parse saved run '%v'", name)
+	}
+	if run.SchemaVersion != SavedRunSchemaVersion {
+		return run, errs.NewErrf("Unsupported schema version %v of saved run '%v'", run.SchemaVersion, name)
+	}
+	slices.Sort(run.LatencyNs)
+	return run, nil
+}
+
+// pick n evenly spaced values, sorted values are still sorted.
+func pickEvenly(v []int64, n int) []int64 {
+	if len(v) <= n {
+		return v
+	}
+	step := float64(len(v)) / float64(n)
+	out := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, v[int(float64(i)*step)])
+	}
+	return out
+}
+
+// Spec of run comparison.
+type CompareSpec struct {
+	// max relative degradation (e.g., 0.05 means 5% slower or 5% less throughput) that is not a regression, by default 0.05.
+	Tolerance float64
+
+	// significance level of the Mann-Whitney U test on latency, by default 0.05.
+	Alpha float64
+}
+
+// Delta of a metric between baseline and current run.
+type MetricDelta struct {
+	Metric         string
+	Baseline       float64 // latency is in nanoseconds
+	Current        float64 // latency is in nanoseconds
+	Delta          float64 // relative change, (current - baseline) / baseline
+	HigherIsBetter bool
+	Degraded       bool // degraded beyond the tolerance
+	Regression     bool // degraded beyond the tolerance, and the latency shift is significant (latency only)
+}
+
+func (m MetricDelta) isLatency() bool {
+	return !m.HigherIsBetter
+}
+
+func (m MetricDelta) formatValue(v float64) string {
+	if m.isLatency() {
+		return time.Duration(v).String()
+	}
+	return fmt.Sprintf("%.0f req/sec", v)
+}
+
+// Result of one-sided Mann-Whitney U test, whether latency of current run tends to be greater than the baseline.
+type MannWhitneyResult struct {
+	Available bool // whether both runs have latency samples
+
+	U float64
+	Z float64
+	P float64 // one-sided p-value
+
+	// probability that a request of current run is slower than a request of baseline, 0.5 means no difference.
+	Effect float64
+}
+
+type Comparison struct {
+	Spec        CompareSpec
+	Baseline    ExportStats
+	Current     ExportStats
+	Metrics     []MetricDelta
+	MannWhitney MannWhitneyResult
+	Significant bool     // whether the latency shift is significant, always true if the test is not available
+	Warnings    []string // e.g., the runs are not configured the same way
+	Regressed   bool
+}
+
+// Compare current run with the baseline, deltas of throughput, avg, median and percentiles are computed,
+// latency is compared using one-sided Mann-Whitney U test.
+//
+// A metric is regressed if it's degraded beyond the tolerance, and for latency metrics, the latency shift must also be significant.
+func CompareRuns(baseline SavedRun, current SavedRun, cs CompareSpec) Comparison {
+	if cs.Tolerance <= 0 {
+		cs.Tolerance = DefaultCompareTolerance
+	}
+	if cs.Alpha <= 0 {
+		cs.Alpha = DefaultCompareAlpha
+	}
+	b, c := baseline.Stats, current.Stats
+	cr := Comparison{Spec: cs, Baseline: b, Current: c}
+
+	cr.MannWhitney = mannWhitneyU(baseline.LatencyNs, current.LatencyNs)
+	cr.Significant = !cr.MannWhitney.Available || cr.MannWhitney.P < cs.Alpha
+
+	cr.Metrics = append(cr.Metrics,
+		newMetricDelta("throughput", b.Throughput, c.Throughput, true),
+		newMetricDelta("avg", float64(b.Latency.AvgNs), float64(c.Latency.AvgNs), false),
+		newMetricDelta("median", float64(b.Latency.MedNs), float64(c.Latency.MedNs), false),
+	)
+	for _, pv := range percentileValues {
+		k := fmt.Sprintf("p%d", pv)
+		bv, bok := b.Latency.PercentilesNs[k]
+		cv, cok := c.Latency.PercentilesNs[k]
+		if bok && cok {
+			cr.Metrics = append(cr.Metrics, newMetricDelta(strings.ToUpper(k), float64(bv), float64(cv), false))
+		}
+	}
+	for i := range cr.Metrics {
+		m := &cr.Metrics[i]
+		m.Degraded = m.Delta > cs.Tolerance
+		if m.HigherIsBetter {
+			m.Degraded = -m.Delta > cs.Tolerance
+		}
+		m.Regression = m.Degraded && (!m.isLatency() || cr.Significant)
+		cr.Regressed = cr.Regressed || m.Regression
+	}
+
+	if b.Concurrency != c.Concurrency || b.Rate != c.Rate {
+		cr.Warnings = append(cr.Warnings, fmt.Sprintf("runs are configured differently (baseline: concurrency %d, rate %v; current: concurrency %d, rate %v)",
+			b.Concurrency, b.Rate, c.Concurrency, c.Rate))
+	}
+	if b.Interrupted || c.Interrupted {
+		cr.Warnings = append(cr.Warnings, "run is interrupted, comparing partial results")
+	}
+	if !cr.MannWhitney.Available {
+		cr.Warnings = append(cr.Warnings, "latency samples are missing, significance test is skipped")
+	}
+	return cr
+}
+
+func newMetricDelta(metric string, baseline float64, current float64, higherIsBetter bool) MetricDelta {
+	m := MetricDelta{Metric: metric, Baseline: baseline, Current: current, HigherIsBetter: higherIsBetter}
+	if baseline != 0 {
+		m.Delta = (current - baseline) / baseline
+	}
+	return m
+}
+
+// one-sided Mann-Whitney U test (normal approximation with tie and continuity correction), H1: current tends to be greater than baseline.
+func mannWhitneyU(baseline []int64, current []int64) MannWhitneyResult {
+	n1, n2 := len(current), len(baseline)
+	if n1 < 1 || n2 < 1 {
+		return MannWhitneyResult{}
+	}
+	type sample struct {
+		v       int64
+		current bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, v := range current {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range baseline {
+		all = append(all, sample{v, false})
+	}
+	slices.SortFunc(all, func(a, b sample) int { return cmp.Compare(a.v, b.v) })
+
+	// rank sum of current run, tied values share the average rank
+	var rankSum, tieSum float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].current {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieSum += t*t*t - t
+		i = j
+	}
+
+	fn1, fn2, n := float64(n1), float64(n2), float64(n1+n2)
+	u := rankSum - fn1*(fn1+1)/2
+	res := MannWhitneyResult{Available: true, U: u, Effect: u / (fn1 * fn2), P: 1}
+	variance := fn1 * fn2 / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if variance <= 0 {
+		return res // all values are the same
+	}
+	res.Z = (u - fn1*fn2/2 - 0.5) / math.Sqrt(variance)
+	res.P = 0.5 * math.Erfc(res.Z/math.Sqrt2)
+	return res
+}
+
+func printComparison(cr Comparison) {
+	sb := strings.Builder{}
+	sb.WriteString("\n--------- Comparison ----------\n\n")
+	sb.WriteString(fmt.Sprintf("baseline: %v (%d requests)\n", cr.Baseline.BenchmarkTime, cr.Baseline.TotalRequests))
+	sb.WriteString(fmt.Sprintf("current: %v (%d requests)\n", cr.Current.BenchmarkTime, cr.Current.TotalRequests))
+	sb.WriteString(fmt.Sprintf("tolerance: %.2f%%\n\n", cr.Spec.Tolerance*100))
+
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "metric\tbaseline\tcurrent\tdelta\tresult\n")
+	for _, m := range cr.Metrics {
+		res := "ok"
+		if m.Regression {
+			res = "REGRESSION"
+		} else if m.Degraded {
+			res = "degraded (not significant)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.2f%%\t%s\n", m.Metric, m.formatValue(m.Baseline), m.formatValue(m.Current), m.Delta*100, res)
+	}
+	tw.Flush()
+
+	if mw := cr.MannWhitney; mw.Available {
+		sb.WriteString(fmt.Sprintf("\nmann_whitney_u: U: %.0f, z: %.4f, p: %.6f (alpha: %v), P(current > baseline): %.4f, significant: %v\n",
+			mw.U, mw.Z, mw.P, cr.Spec.Alpha, mw.Effect, cr.Significant))
+	}
+	for _, w := range cr.Warnings {
+		sb.WriteString(fmt.Sprintf("warning: %s\n", w))
+	}
+	sb.WriteString(fmt.Sprintf("\nregressed: %v\n", cr.Regressed))
+	sb.WriteString("\n-------------------------------\n")
+	print(sb.String())
+}
+
+// Load two saved runs, compare and print the deltas, ErrRegression is returned if regression is detected.
+func CompareRunFiles(baselineFile string, currentFile string, cs CompareSpec) (Comparison, error) {
+	baseline, err := LoadRun(baselineFile)
+	if err != nil {
+		return Comparison{}, err
+	}
+	current, err := LoadRun(currentFile)
+	if err != nil {
+		return Comparison{}, err
+	}
+	cr := CompareRuns(baseline, current, cs)
+	printComparison(cr)
+	if cr.Regressed {
+		var failed []string
+		for _, m := range cr.Metrics {
+			if m.Regression {
+				failed = append(failed, fmt.Sprintf("%s %+.2f%%", m.Metric, m.Delta*100))
+			}
+		}
+		return cr, ErrRegression.WithInternalMsg("%v", strings.Join(failed, ", "))
+	}
+	return cr, nil
+}
@@ -0,0 +1,185 @@
+package benchmarker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/spf13/cast"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+)
+
+const (
+	defPlotConcGroupThroughputFilename = "plot_concgroup_throughput.png"
+	defPlotConcGroupLatencyFilename    = "plot_concgroup_latency.png"
+)
+
+// Benchmark of one concurrency group.
+type ConcGroup struct {
+	Concurrency int
+	Stats       Stats
+	Benchmarks  []Benchmark
+}
+
+// Parse concurrency groups, e.g., '1,30,50', blank and non-positive values are ignored.
+func ParseConcGroups(s string) []int {
+	var groups []int
+	for _, t := range strings.Split(s, ",") {
+		if util.IsBlankStr(t) {
+			continue
+		}
+		if c := cast.ToInt(strings.TrimSpace(t)); c > 0 {
+			groups = append(groups, c)
+		}
+	}
+	return groups
+}
+
+// Run the benchmark once for each concurrency group, a summary table and plots of throughput and latency vs concurrency are generated.
+//
+// Output files of each group are prefixed with 'conc{concurrency}_'. If thresholds of any group are breached, the remaining groups
+// are still executed and ErrThresholdBreached is returned in the end.
+func StartConcGroupBenchmark(spec BenchmarkSpec, groups []int) ([]ConcGroup, error) {
+	return StartConcGroupBenchmarkContext(context.Background(), spec, groups)
+}
+
+// Same as StartConcGroupBenchmark, but the benchmark is stopped once ctx is done, ErrInterrupted is returned along with the completed groups.
+func StartConcGroupBenchmarkContext(ctx context.Context, spec BenchmarkSpec, groups []int) ([]ConcGroup, error) {
+	if len(groups) < 1 {
+		return nil, errs.NewErrf("Concurrency groups are empty")
+	}
+	if spec.PlotWidth == 0 {
+		spec.PlotWidth = defPlotWidth
+	}
+	if spec.PlotHeight == 0 {
+		spec.PlotHeight = defPlotHeight
+	}
+	if spec.PlotConcGroupThroughputFilename == "" {
+		spec.PlotConcGroupThroughputFilename = defPlotConcGroupThroughputFilename
+	}
+	if spec.PlotConcGroupLatencyFilename == "" {
+		spec.PlotConcGroupLatencyFilename = defPlotConcGroupLatencyFilename
+	}
+	spec.benchmarkTime = util.Now().FormatClassicLocale()
+
+	res := make([]ConcGroup, 0, len(groups))
+	var groupErr error
+	for _, c := range groups {
+		cp := withFilePrefix(spec, "conc"+cast.ToString(c)+"_") // this is a value copy
+		cp.Concurrent = c                                       // change concurrency value
+
+		b, s, err := StartBenchmarkContext(ctx, cp)
+		res = append(res, ConcGroup{Concurrency: c, Stats: s, Benchmarks: b})
+		if errors.Is(err, ErrThresholdBreached) {
+			groupErr = err // the remaining groups are still executed
+			continue
+		}
+		if errors.Is(err, ErrInterrupted) {
+			groupErr = err // summary of the completed groups is still generated
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+
+	printConcGroups(res)
+	if !spec.DisablePlotGraphs {
+		if err := plotConcGroups(spec, res); err != nil {
+			return res, err
+		}
+	}
+	return res, groupErr
+}
+
+func printConcGroups(groups []ConcGroup) {
+	corrected := false
+	for _, g := range groups {
+		corrected = corrected || g.Stats.Corrected != nil
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("\n--------- Concurrency Groups --\n\n")
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "concurrency\trequests\tthroughput\tmedian\tP90\tP99")
+	if corrected {
+		fmt.Fprintf(tw, "\tcorrected_P99")
+	}
+	fmt.Fprintf(tw, "\terror_rate\tinterrupted\n")
+	for _, g := range groups {
+		st := g.Stats
+		fmt.Fprintf(tw, "%d\t%d\t%.0f req/sec\t%v\t%v\t%v", g.Concurrency, st.TotalRequests, st.Throughput, st.Med,
+			st.Percentiles[90].Record.Took, st.Percentiles[99].Record.Took)
+		if corrected {
+			var p99 time.Duration
+			if st.Corrected != nil {
+				p99 = st.Corrected.Percentiles[99]
+			}
+			fmt.Fprintf(tw, "\t%v", p99)
+		}
+		fmt.Fprintf(tw, "\t%.4f\t%v\n", st.ErrorRate(), st.Interrupted)
+	}
+	tw.Flush()
+	sb.WriteString("\n-------------------------------\n")
+	print(sb.String())
+}
+
+// plot throughput and latency percentiles against concurrency.
+func plotConcGroups(spec BenchmarkSpec, groups []ConcGroup) error {
+	var (
+		stats                   Stats
+		throughput, p50, p99    plotter.XYs
+		correctedP99            plotter.XYs
+		minConc, maxConc, total int
+	)
+	for i, g := range groups {
+		st := g.Stats
+		stats.Interrupted = stats.Interrupted || st.Interrupted
+		if i == 0 || g.Concurrency < minConc {
+			minConc = g.Concurrency
+		}
+		maxConc = max(maxConc, g.Concurrency)
+		total += st.TotalRequests
+		if st.TotalRequests < 1 {
+			continue
+		}
+		x := float64(g.Concurrency)
+		throughput = append(throughput, plotter.XY{X: x, Y: st.Throughput})
+		p50 = append(p50, plotter.XY{X: x, Y: durMs(st.Med)})
+		p99 = append(p99, plotter.XY{X: x, Y: durMs(st.Percentiles[99].Record.Took)})
+		if st.Corrected != nil {
+			correctedP99 = append(correctedP99, plotter.XY{X: x, Y: durMs(st.Corrected.Percentiles[99])})
+		}
+	}
+	if len(throughput) < 1 {
+		return nil
+	}
+	titleStats := fmt.Sprintf("(%d Groups, Concurrency: %d - %d, Total %d Requests)", len(groups), minConc, maxConc, total)
+	xlabel := "X - Concurrency"
+
+	tp := newPlot(stats, spec.benchmarkTime+" - Throughput vs Concurrency Plot "+titleStats, xlabel, "Throughput (req/sec)")
+	if err := plotutil.AddLinePoints(tp, "Throughput", throughput); err != nil {
+		return err
+	}
+	tp.X.Min, tp.Y.Min = 0, 0
+	if err := savePlot(spec, tp, spec.PlotConcGroupThroughputFilename); err != nil {
+		return err
+	}
+
+	lp := newPlot(stats, spec.benchmarkTime+" - Latency vs Concurrency Plot "+titleStats, xlabel, "Request Latency (ms)")
+	vs := []any{"P50", p50, "P99", p99}
+	if len(correctedP99) > 0 {
+		vs = append(vs, "Corrected P99", correctedP99)
+	}
+	if err := plotutil.AddLinePoints(lp, vs...); err != nil {
+		return err
+	}
+	lp.X.Min, lp.Y.Min = 0, 0
+	return savePlot(spec, lp, spec.PlotConcGroupLatencyFilename)
+}
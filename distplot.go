@@ -0,0 +1,146 @@
+package benchmarker
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+)
+
+const (
+	// split latency distribution plots by http status code.
+	PlotSplitByStatus = "status"
+
+	// split latency distribution plots by success or failure.
+	PlotSplitBySuccess = "success"
+
+	histPlotBucketsPerDecade = 20   // number of log-scaled buckets for each 10x of latency
+	cdfPlotMaxPoints         = 2000 // max number of points of each cdf line
+	distPlotMinLatency       = 0.001
+)
+
+func isValidPlotSplitBy(s string) bool {
+	return s == "" || s == PlotSplitByStatus || s == PlotSplitBySuccess
+}
+
+// records of the same group, e.g., the same http status.
+type latencyGroup struct {
+	Name string
+	Took []float64 // latency in ms, sorted
+}
+
+// group latencies by spec.PlotSplitBy, the first group always contains all the records, bench is sorted by latency.
+func toLatencyGroups(spec BenchmarkSpec, bench []Benchmark) []latencyGroup {
+	all := latencyGroup{Name: "All", Took: make([]float64, 0, len(bench))}
+	byKey := map[string]*latencyGroup{}
+	var keys []string
+	for i := range bench {
+		took := max(durMs(bench[i].Took), distPlotMinLatency) // log scale doesn't support zero
+		all.Took = append(all.Took, took)
+
+		var key string
+		switch spec.PlotSplitBy {
+		case PlotSplitByStatus:
+			key = fmt.Sprintf("Status %d", bench[i].HttpStatus)
+		case PlotSplitBySuccess:
+			key = "Failure"
+			if bench[i].Success {
+				key = "Success"
+			}
+		default:
+			continue
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &latencyGroup{Name: key}
+			byKey[key] = g
+			keys = append(keys, key)
+		}
+		g.Took = append(g.Took, took)
+	}
+
+	groups := []latencyGroup{all}
+	sort.Strings(keys)
+	for _, k := range keys {
+		groups = append(groups, *byKey[k])
+	}
+	return groups
+}
+
+// number of records in each log-scaled bucket, x is the geometric center of the bucket.
+func histogramXYs(took []float64, minMs float64, maxMs float64) plotter.XYs {
+	lo := math.Floor(math.Log10(minMs) * histPlotBucketsPerDecade)
+	hi := math.Floor(math.Log10(maxMs)*histPlotBucketsPerDecade) + 1
+	counts := make([]int, int(hi-lo))
+	for _, v := range took {
+		i := int(math.Floor(math.Log10(v)*histPlotBucketsPerDecade) - lo)
+		counts[min(max(i, 0), len(counts)-1)]++
+	}
+	pts := make(plotter.XYs, 0, len(counts))
+	for i, c := range counts {
+		x := math.Pow(10, (lo+float64(i)+0.5)/histPlotBucketsPerDecade)
+		pts = append(pts, plotter.XY{X: x, Y: float64(c)})
+	}
+	return pts
+}
+
+// cumulative percentage of records, took is sorted, the points are downsampled to cdfPlotMaxPoints.
+func cdfXYs(took []float64) plotter.XYs {
+	n := len(took)
+	step := max(1, n/cdfPlotMaxPoints)
+	pts := make(plotter.XYs, 0, n/step+1)
+	for i := 0; i < n; i += step {
+		pts = append(pts, plotter.XY{X: took[i], Y: float64(i+1) / float64(n) * 100})
+	}
+	if last := n - 1; last%step != 0 {
+		pts = append(pts, plotter.XY{X: took[last], Y: 100})
+	}
+	return pts
+}
+
+// plot latency histogram (log-scaled buckets) and cumulative distribution, bench is sorted by latency.
+func plotDistributionGraphs(spec BenchmarkSpec, bench []Benchmark, stats Stats) error {
+	if len(bench) < 1 {
+		return nil
+	}
+	groups := toLatencyGroups(spec, bench)
+	all := groups[0].Took
+	minMs, maxMs := all[0], all[len(all)-1]
+	titleStats := fmt.Sprintf("(Total %d Requests, Concurrency: %v, Max: %v, Min: %v, Avg: %v, Median: %v, %v)",
+		len(bench), spec.Concurrent, stats.Max, stats.Min, stats.Avg, stats.Med, stats.PercentileString())
+
+	hist := distPlot(stats, spec.benchmarkTime+" - Latency Histogram Plot "+titleStats, "Number of Requests")
+	var hvs []any
+	for _, g := range groups {
+		hvs = append(hvs, g.Name, histogramXYs(g.Took, minMs, maxMs))
+	}
+	if err := plotutil.AddLinePoints(hist, hvs...); err != nil {
+		return err
+	}
+	hist.Y.Min = 0
+	if err := savePlot(spec, hist, spec.PlotHistogramFilename); err != nil {
+		return err
+	}
+
+	cdf := distPlot(stats, spec.benchmarkTime+" - Latency CDF Plot "+titleStats, "Cumulative Percentage of Requests (%)")
+	var cvs []any
+	for _, g := range groups {
+		cvs = append(cvs, g.Name, cdfXYs(g.Took))
+	}
+	if err := plotutil.AddLines(cdf, cvs...); err != nil {
+		return err
+	}
+	cdf.Y.Min = 0
+	cdf.Y.Max = 101
+	return savePlot(spec, cdf, spec.PlotCdfFilename)
+}
+
+func distPlot(stats Stats, title string, ylabel string) *plot.Plot {
+	p := newPlot(stats, title, "X - Request Latency (ms, log scale)", ylabel)
+	p.X.Scale = plot.LogScale{}
+	p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+	return p
+}
@@ -0,0 +1,405 @@
+package benchmarker
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/spf13/cast"
+)
+
+const (
+	OutputFormatText   = "text"
+	OutputFormatJson   = "json"
+	OutputFormatCsv    = "csv"
+	OutputFormatNdjson = "ndjson"
+
+	// version of the exported schema, it's only changed when the existing fields are changed or removed.
+	ExportSchemaVersion = 1
+)
+
+// Exported run, used by json output format.
+type ExportRun struct {
+	SchemaVersion int            `json:"schema_version"`
+	Stats         ExportStats    `json:"stats"`
+	Records       []ExportRecord `json:"records"`
+}
+
+type ExportStats struct {
+	BenchmarkTime    string                   `json:"benchmark_time"`
+	Interrupted      bool                     `json:"interrupted"` // partial results, the benchmark is interrupted
+	Concurrency      int                      `json:"concurrency"`
+	Rate             float64                  `json:"rate"`
+	Round            int                      `json:"round"`
+	DurationNs       int64                    `json:"duration_ns"`
+	TotalTimeNs      int64                    `json:"total_time_ns"`
+	TotalRequests    int                      `json:"total_requests"`
+	Throughput       float64                  `json:"throughput"`
+	StatusCount      map[string]int           `json:"status_count"`
+	SuccessCount     int                      `json:"success_count"`
+	FailCount        int                      `json:"fail_count"`
+	ErrorRate        float64                  `json:"error_rate"`
+	Latency          ExportLatency            `json:"latency"`
+	CorrectedLatency *ExportLatency           `json:"corrected_latency"` // null unless it's in Rate mode
+	Phases           map[string]ExportLatency `json:"phases"`
+	Scenarios        map[string]ExportStats   `json:"scenarios,omitempty"` // only present if BenchmarkSpec.Scenarios is specified
+	Steps            map[string]ExportStats   `json:"steps,omitempty"`     // only present in stats of journey scenarios
+	Journey          *ExportJourney           `json:"journey,omitempty"`   // only present in stats of journey scenarios
+	WebSocket        *ExportWebSocket         `json:"websocket,omitempty"` // only present if BenchmarkSpec.WebSocket is specified
+}
+
+type ExportJourney struct {
+	Latency      ExportLatency `json:"latency"`
+	SuccessCount int           `json:"success_count"`
+	FailCount    int           `json:"fail_count"`
+	Throughput   float64       `json:"throughput"` // journeys/sec
+}
+
+type ExportWebSocket struct {
+	Connections       int           `json:"connections"`
+	FailedConnections int           `json:"failed_connections"`
+	Connect           ExportLatency `json:"connect"`
+	Sent              int           `json:"sent"`
+	Received          int           `json:"received"`
+	Dropped           int           `json:"dropped"`
+	Failed            int           `json:"failed"`
+	Unmatched         int           `json:"unmatched"`
+}
+
+type ExportLatency struct {
+	Count         int              `json:"count"`
+	MinNs         int64            `json:"min_ns"`
+	MaxNs         int64            `json:"max_ns"`
+	AvgNs         int64            `json:"avg_ns"`
+	MedNs         int64            `json:"med_ns"`
+	PercentilesNs map[string]int64 `json:"percentiles_ns"` // e.g., {"p99": 1000000}
+}
+
+type ExportRecord struct {
+	TimestampUs         int64          `json:"timestamp_us"`
+	IntendedTimestampUs int64          `json:"intended_timestamp_us"`
+	TookNs              int64          `json:"took_ns"`
+	CorrectedTookNs     int64          `json:"corrected_took_ns"`
+	DNSLookupNs         int64          `json:"dns_lookup_ns"`
+	TCPConnectNs        int64          `json:"tcp_connect_ns"`
+	TLSHandshakeNs      int64          `json:"tls_handshake_ns"`
+	TTFBNs              int64          `json:"ttfb_ns"`
+	BodyTransferNs      int64          `json:"body_transfer_ns"`
+	Success             bool           `json:"success"`
+	SuccessRate         float64        `json:"success_rate"`
+	HttpStatus          int            `json:"http_status"`
+	Extra               map[string]any `json:"extra"`
+	Scenario            string         `json:"scenario"`
+	Step                string         `json:"step"`
+	JourneyTookNs       int64          `json:"journey_took_ns"` // only set on the last step sent in the journey
+}
+
+// ndjson line, Type is either 'stats' or 'record', only one of Stats and Record is present.
+type exportLine struct {
+	Type          string        `json:"type"`
+	SchemaVersion int           `json:"schema_version"`
+	Stats         *ExportStats  `json:"stats,omitempty"`
+	Record        *ExportRecord `json:"record,omitempty"`
+}
+
+var (
+	exportRecordCsvHeader = []string{"timestamp_us", "intended_timestamp_us", "took_ns", "corrected_took_ns", "dns_lookup_ns",
+		"tcp_connect_ns", "tls_handshake_ns", "ttfb_ns", "body_transfer_ns", "success", "success_rate", "http_status", "extra", "scenario", "step", "journey_took_ns"}
+)
+
+func isValidOutputFormat(f string) bool {
+	return util.EqualAnyStr(f, OutputFormatText, OutputFormatJson, OutputFormatCsv, OutputFormatNdjson)
+}
+
+func defaultDataOutputFilename(format string) string {
+	if format == "" || format == OutputFormatText {
+		return defDataOutputFilename
+	}
+	return util.FileChangeSuffix(defDataOutputFilename, format)
+}
+
+// name of the file that contains the stats in csv format.
+func csvStatsFilename(dataOutputFilename string) string {
+	name, _, _ := util.FileCutDotSuffix(dataOutputFilename)
+	return name + "_stats.csv"
+}
+
+func NewExportStats(spec BenchmarkSpec, stats Stats) ExportStats {
+	es := ExportStats{
+		BenchmarkTime: spec.benchmarkTime,
+		Interrupted:   stats.Interrupted,
+		Concurrency:   spec.Concurrent,
+		Rate:          spec.Rate,
+		Round:         spec.Round,
+		DurationNs:    int64(spec.Duration),
+		TotalTimeNs:   int64(stats.TotalTime),
+		TotalRequests: stats.TotalRequests,
+		Throughput:    stats.Throughput,
+		StatusCount:   make(map[string]int, len(stats.StatusCount)),
+		SuccessCount:  stats.SuccessCount[true],
+		FailCount:     stats.SuccessCount[false],
+		ErrorRate:     stats.ErrorRate(),
+		Phases:        make(map[string]ExportLatency, len(stats.Phases)),
+	}
+	for k, v := range stats.StatusCount {
+		es.StatusCount[cast.ToString(k)] = v
+	}
+
+	es.Latency = ExportLatency{
+		Count:         stats.TotalRequests,
+		MinNs:         int64(stats.Min),
+		MaxNs:         int64(stats.Max),
+		AvgNs:         int64(stats.Avg),
+		MedNs:         int64(stats.Med),
+		PercentilesNs: make(map[string]int64, len(stats.Percentiles)),
+	}
+	for k, v := range stats.Percentiles {
+		es.Latency.PercentilesNs[fmt.Sprintf("p%d", k)] = int64(v.Record.Took)
+	}
+	if stats.Corrected != nil {
+		c := newExportLatency(*stats.Corrected)
+		es.CorrectedLatency = &c
+	}
+	for k, v := range stats.Phases {
+		es.Phases[k] = newExportLatency(v)
+	}
+	if len(stats.Scenarios) > 0 {
+		es.Scenarios = make(map[string]ExportStats, len(stats.Scenarios))
+		for k, v := range stats.Scenarios {
+			es.Scenarios[k] = NewExportStats(spec, v)
+		}
+	}
+	if len(stats.Steps) > 0 {
+		es.Steps = make(map[string]ExportStats, len(stats.Steps))
+		for k, v := range stats.Steps {
+			es.Steps[k] = NewExportStats(spec, v)
+		}
+	}
+	if js := stats.Journey; js != nil {
+		es.Journey = &ExportJourney{
+			Latency:      newExportLatency(js.LatencyStats),
+			SuccessCount: js.SuccessCount[true],
+			FailCount:    js.SuccessCount[false],
+			Throughput:   js.Throughput,
+		}
+	}
+	if ws := stats.WebSocket; ws != nil {
+		es.WebSocket = &ExportWebSocket{
+			Connections:       ws.Connections,
+			FailedConnections: ws.FailedConnections,
+			Connect:           newExportLatency(ws.Connect),
+			Sent:              ws.Sent,
+			Received:          ws.Received,
+			Dropped:           ws.Dropped,
+			Failed:            ws.Failed,
+			Unmatched:         ws.Unmatched,
+		}
+	}
+	return es
+}
+
+func newExportLatency(ls LatencyStats) ExportLatency {
+	el := ExportLatency{
+		Count:         ls.Count,
+		MinNs:         int64(ls.Min),
+		MaxNs:         int64(ls.Max),
+		AvgNs:         int64(ls.Avg),
+		MedNs:         int64(ls.Med),
+		PercentilesNs: make(map[string]int64, len(ls.Percentiles)),
+	}
+	for k, v := range ls.Percentiles {
+		el.PercentilesNs[fmt.Sprintf("p%d", k)] = int64(v)
+	}
+	return el
+}
+
+func NewExportRecord(b Benchmark) ExportRecord {
+	extra := b.Extra
+	if extra == nil {
+		extra = map[string]any{}
+	}
+	return ExportRecord{
+		TimestampUs:         b.Timestamp,
+		IntendedTimestampUs: b.IntendedTimestamp,
+		TookNs:              int64(b.Took),
+		CorrectedTookNs:     int64(b.CorrectedTook),
+		DNSLookupNs:         int64(b.DNSLookup),
+		TCPConnectNs:        int64(b.TCPConnect),
+		TLSHandshakeNs:      int64(b.TLSHandshake),
+		TTFBNs:              int64(b.TTFB),
+		BodyTransferNs:      int64(b.BodyTransfer),
+		Success:             b.Success,
+		SuccessRate:         b.successRate,
+		HttpStatus:          b.HttpStatus,
+		Extra:               extra,
+		Scenario:            b.Scenario,
+		Step:                b.Step,
+		JourneyTookNs:       int64(b.JourneyTook),
+	}
+}
+
+// write stats and records to data output file in structured format (json, csv or ndjson).
+func writeExport(spec BenchmarkSpec, stats Stats, bench []Benchmark) error {
+	es := NewExportStats(spec, stats)
+	switch spec.OutputFormat {
+	case OutputFormatJson:
+		return writeFile(spec.DataOutputFilename, func(w io.Writer) error {
+			run := ExportRun{SchemaVersion: ExportSchemaVersion, Stats: es, Records: make([]ExportRecord, 0, len(bench))}
+			for _, b := range bench {
+				run.Records = append(run.Records, NewExportRecord(b))
+			}
+			s, err := json.SWriteIndent(run)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, s)
+			return err
+		})
+	case OutputFormatNdjson:
+		return writeFile(spec.DataOutputFilename, func(w io.Writer) error {
+			if err := json.EncodeJson(w, exportLine{Type: "stats", SchemaVersion: ExportSchemaVersion, Stats: &es}); err != nil {
+				return err
+			}
+			for _, b := range bench {
+				r := NewExportRecord(b)
+				if err := json.EncodeJson(w, exportLine{Type: "record", SchemaVersion: ExportSchemaVersion, Record: &r}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case OutputFormatCsv:
+		err := writeFile(csvStatsFilename(spec.DataOutputFilename), func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"metric", "value"})
+			cw.WriteAll(flattenExportStats(es))
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+		return writeFile(spec.DataOutputFilename, func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write(exportRecordCsvHeader)
+			for _, b := range bench {
+				r := NewExportRecord(b)
+				extra, err := json.SWriteJson(r.Extra)
+				if err != nil {
+					return err
+				}
+				cw.Write([]string{
+					cast.ToString(r.TimestampUs), cast.ToString(r.IntendedTimestampUs), cast.ToString(r.TookNs), cast.ToString(r.CorrectedTookNs),
+					cast.ToString(r.DNSLookupNs), cast.ToString(r.TCPConnectNs), cast.ToString(r.TLSHandshakeNs), cast.ToString(r.TTFBNs),
+					cast.ToString(r.BodyTransferNs), cast.ToString(r.Success), fmt.Sprintf("%.4f", r.SuccessRate), cast.ToString(r.HttpStatus), extra, r.Scenario,
+					r.Step, cast.ToString(r.JourneyTookNs),
+				})
+			}
+			cw.Flush()
+			return cw.Error()
+		})
+	}
+	return errs.NewErrf("Unsupported output format: '%v'", spec.OutputFormat)
+}
+
+// flatten stats into (metric, value) rows, metrics are sorted for stable output.
+func flattenExportStats(es ExportStats) [][]string {
+	rows := [][]string{
+		{"schema_version", cast.ToString(ExportSchemaVersion)},
+		{"benchmark_time", es.BenchmarkTime},
+		{"interrupted", cast.ToString(es.Interrupted)},
+		{"concurrency", cast.ToString(es.Concurrency)},
+		{"rate", cast.ToString(es.Rate)},
+		{"round", cast.ToString(es.Round)},
+		{"duration_ns", cast.ToString(es.DurationNs)},
+		{"total_time_ns", cast.ToString(es.TotalTimeNs)},
+		{"total_requests", cast.ToString(es.TotalRequests)},
+		{"throughput", fmt.Sprintf("%.4f", es.Throughput)},
+		{"success_count", cast.ToString(es.SuccessCount)},
+		{"fail_count", cast.ToString(es.FailCount)},
+		{"error_rate", fmt.Sprintf("%.6f", es.ErrorRate)},
+	}
+	for _, k := range sortedKeys(es.StatusCount) {
+		rows = append(rows, []string{"status_count." + k, cast.ToString(es.StatusCount[k])})
+	}
+
+	latencyRows := func(prefix string, l ExportLatency) {
+		rows = append(rows,
+			[]string{prefix + ".count", cast.ToString(l.Count)},
+			[]string{prefix + ".min_ns", cast.ToString(l.MinNs)},
+			[]string{prefix + ".max_ns", cast.ToString(l.MaxNs)},
+			[]string{prefix + ".avg_ns", cast.ToString(l.AvgNs)},
+			[]string{prefix + ".med_ns", cast.ToString(l.MedNs)},
+		)
+		for _, k := range sortedKeys(l.PercentilesNs) {
+			rows = append(rows, []string{prefix + "." + k + "_ns", cast.ToString(l.PercentilesNs[k])})
+		}
+	}
+	latencyRows("latency", es.Latency)
+	if es.CorrectedLatency != nil {
+		latencyRows("corrected_latency", *es.CorrectedLatency)
+	}
+	for _, k := range sortedKeys(es.Phases) {
+		latencyRows("phases."+k, es.Phases[k])
+	}
+	if js := es.Journey; js != nil {
+		latencyRows("journey.latency", js.Latency)
+		rows = append(rows,
+			[]string{"journey.success_count", cast.ToString(js.SuccessCount)},
+			[]string{"journey.fail_count", cast.ToString(js.FailCount)},
+			[]string{"journey.throughput", fmt.Sprintf("%.4f", js.Throughput)},
+		)
+	}
+	if ws := es.WebSocket; ws != nil {
+		rows = append(rows,
+			[]string{"websocket.connections", cast.ToString(ws.Connections)},
+			[]string{"websocket.failed_connections", cast.ToString(ws.FailedConnections)},
+		)
+		latencyRows("websocket.connect", ws.Connect)
+		rows = append(rows,
+			[]string{"websocket.sent", cast.ToString(ws.Sent)},
+			[]string{"websocket.received", cast.ToString(ws.Received)},
+			[]string{"websocket.dropped", cast.ToString(ws.Dropped)},
+			[]string{"websocket.failed", cast.ToString(ws.Failed)},
+			[]string{"websocket.unmatched", cast.ToString(ws.Unmatched)},
+		)
+	}
+	nested := func(prefix string, m map[string]ExportStats) {
+		for _, k := range sortedKeys(m) {
+			for _, row := range flattenExportStats(m[k]) {
+				if row[0] == "schema_version" || row[0] == "benchmark_time" || row[0] == "interrupted" {
+					continue
+				}
+				rows = append(rows, []string{prefix + "." + k + "." + row[0], row[1]})
+			}
+		}
+	}
+	nested("scenarios", es.Scenarios)
+	nested("steps", es.Steps)
+	return rows
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := util.MapKeys(m)
+	sort.Strings(keys)
+	return keys
+}
+
+func writeFile(name string, f func(w io.Writer) error) error {
+	file, err := util.ReadWriteFile(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_ = file.Truncate(0)
+
+	w := bufio.NewWriter(file)
+	if err := f(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
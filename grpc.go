@@ -0,0 +1,341 @@
+package benchmarker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/curtisnewbie/miso/util/expr"
+	"github.com/spf13/cast"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// key in Benchmark.Extra, number of messages received from a server-streaming method.
+	ExtraGrpcMessages = "MESSAGES"
+
+	defGrpcTimeout = 10 * time.Second
+)
+
+type GrpcSpec struct {
+	// required, target address, e.g., 'localhost:50051'.
+	Target string
+
+	// required, full method name, e.g., 'helloworld.Greeter/SayHello', only unary and server-streaming methods are supported.
+	Method string
+
+	// optional, descriptor set file (protoc --include_imports --descriptor_set_out=...), server reflection is used if it's empty.
+	DescriptorSetFile string
+
+	// use TLS, by default plaintext is used.
+	Tls bool
+
+	// optional, func to build the request message in json, by default an empty message is sent.
+	BuildMsgFunc func() ([]byte, error)
+
+	// optional, func to build the request metadata.
+	BuildMetadataFunc func() (map[string]string, error)
+
+	// optional, timeout of each call, by default 10s.
+	Timeout time.Duration
+
+	// optional, number of connections, calls are spread over the connections in round-robin, by default 1.
+	//
+	// A connection only allows a limited number of concurrent streams (e.g., 100), calls beyond the limit are queued
+	// on the client side, increase it at high concurrency so that queueing is not measured as latency.
+	Connections int
+}
+
+// create GrpcInvoker for the CLI, rawUrl is in format 'grpc://host:port/package.Service/Method' (or grpcs:// for TLS).
+func newCliGrpcInvoker(rawUrl string, protoset string, conns int, msgExpr *expr.Expr[map[string]any], mdExpr *expr.Expr[map[string]any],
+	env map[string]any) (*GrpcInvoker, error) {
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "invalid gRPC url '%v'", rawUrl)
+	}
+	spec := GrpcSpec{Target: u.Host, Method: u.Path, DescriptorSetFile: protoset, Tls: u.Scheme == "grpcs", Connections: conns}
+	if msgExpr != nil {
+		spec.BuildMsgFunc = func() ([]byte, error) {
+			out, err := msgExpr.Eval(env)
+			if err != nil {
+				return nil, err
+			}
+			return json.WriteJson(out)
+		}
+	}
+	if mdExpr != nil {
+		spec.BuildMetadataFunc = func() (map[string]string, error) {
+			out, err := mdExpr.Eval(env)
+			if err != nil {
+				return nil, err
+			}
+			return cast.ToStringMapStringE(out)
+		}
+	}
+	return NewGrpcInvoker(spec)
+}
+
+// GrpcInvoker invokes unary or server-streaming gRPC method with dynamic messages, it's safe for concurrent use.
+//
+// Invoke can be used as BenchmarkSpec.InvokeFunc, the gRPC status code is recorded as the status code (Benchmark.HttpStatus).
+type GrpcInvoker struct {
+	spec       GrpcSpec
+	conns      []*grpc.ClientConn
+	next       atomic.Uint64
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+}
+
+// Create GrpcInvoker, the method descriptor is resolved using the descriptor set or server reflection.
+func NewGrpcInvoker(spec GrpcSpec) (*GrpcInvoker, error) {
+	if spec.Timeout <= 0 {
+		spec.Timeout = defGrpcTimeout
+	}
+	if spec.Connections < 1 {
+		spec.Connections = 1
+	}
+	svc, mth, ok := strings.Cut(strings.TrimPrefix(spec.Method, "/"), "/")
+	if !ok || svc == "" || mth == "" {
+		return nil, errs.NewErrf("Invalid gRPC method '%v', should be in format 'package.Service/Method'", spec.Method)
+	}
+
+	creds := insecure.NewCredentials()
+	if spec.Tls {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	g := &GrpcInvoker{spec: spec, conns: make([]*grpc.ClientConn, 0, spec.Connections), fullMethod: "/" + svc + "/" + mth}
+	for i := 0; i < spec.Connections; i++ {
+		conn, err := grpc.NewClient(spec.Target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			g.Close()
+			return nil, errs.WrapErrf(err, "failed to create gRPC client for '%v'", spec.Target)
+		}
+		g.conns = append(g.conns, conn)
+	}
+
+	var files *protoregistry.Files
+	var err error
+	if spec.DescriptorSetFile != "" {
+		files, err = loadDescriptorSet(spec.DescriptorSetFile)
+	} else {
+		files, err = reflectDescriptors(g.conns[0], svc, spec.Timeout)
+	}
+	if err == nil {
+		g.method, err = findGrpcMethod(files, svc, mth)
+	}
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// Close the underlying connections.
+func (g *GrpcInvoker) Close() error {
+	var err error
+	for _, c := range g.conns {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// Invoke the method once, implements InvokeFunc, the call is cancelled once ctx is done.
+func (g *GrpcInvoker) Invoke(ctx context.Context) (Result, error) {
+	req := dynamicpb.NewMessage(g.method.Input())
+	if g.spec.BuildMsgFunc != nil {
+		buf, err := g.spec.BuildMsgFunc()
+		if err != nil {
+			return Result{}, err
+		}
+		if err := protojson.Unmarshal(buf, req); err != nil {
+			return Result{}, errs.WrapErrf(err, "failed to build request message of '%v'", g.method.Input().FullName())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.spec.Timeout)
+	defer cancel()
+	conn := g.conns[(g.next.Add(1)-1)%uint64(len(g.conns))]
+	if g.spec.BuildMetadataFunc != nil {
+		md, err := g.spec.BuildMetadataFunc()
+		if err != nil {
+			return Result{}, err
+		}
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(md))
+	}
+
+	if !g.method.IsStreamingServer() {
+		res := dynamicpb.NewMessage(g.method.Output())
+		return grpcResult(conn.Invoke(ctx, g.fullMethod, req, res)), nil
+	}
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, g.fullMethod)
+	if err != nil {
+		return grpcResult(err), nil
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return grpcResult(err), nil
+	}
+	if err := stream.CloseSend(); err != nil {
+		return grpcResult(err), nil
+	}
+	n := 0
+	for {
+		if err := stream.RecvMsg(dynamicpb.NewMessage(g.method.Output())); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			r := grpcResult(err)
+			if r.Extra == nil {
+				r.Extra = map[string]any{}
+			}
+			r.Extra[ExtraGrpcMessages] = n
+			return r, nil
+		}
+		n++
+	}
+}
+
+func grpcResult(err error) Result {
+	st := status.Convert(err)
+	r := Result{HttpStatus: int(st.Code()), Success: st.Code() == codes.OK}
+	if err != nil {
+		r.Extra = map[string]any{"ERROR": st.Message()}
+	}
+	return r
+}
+
+func findGrpcMethod(files *protoregistry.Files, svc string, mth string) (protoreflect.MethodDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(svc))
+	if err != nil {
+		return nil, errs.WrapErrf(err, "gRPC service '%v' not found", svc)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errs.NewErrf("'%v' is not a gRPC service", svc)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(mth))
+	if md == nil {
+		return nil, errs.NewErrf("gRPC method '%v' not found in service '%v'", mth, svc)
+	}
+	if md.IsStreamingClient() {
+		return nil, errs.NewErrf("gRPC method '%v/%v' is client-streaming, only unary and server-streaming methods are supported", svc, mth)
+	}
+	return md, nil
+}
+
+// load descriptor set file, e.g., generated by 'protoc --include_imports --descriptor_set_out=...'.
+func loadDescriptorSet(file string) (*protoregistry.Files, error) {
+	buf, err := util.ReadFileAll(file)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "failed to read descriptor set file '%v'", file)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(buf, &set); err != nil {
+		return nil, errs.WrapErrf(err, "invalid descriptor set file '%v'", file)
+	}
+	fdps := make(map[string]*descriptorpb.FileDescriptorProto, len(set.File))
+	for _, f := range set.File {
+		fdps[f.GetName()] = f
+	}
+	return buildFiles(fdps, nil)
+}
+
+// resolve descriptors of the service (and its dependencies) using server reflection.
+func reflectDescriptors(conn *grpc.ClientConn, svc string, timeout time.Duration) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "failed to call server reflection")
+	}
+	defer stream.CloseSend()
+
+	fdps := map[string]*descriptorpb.FileDescriptorProto{}
+	fetch := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return errs.WrapErrf(err, "failed to call server reflection")
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return errs.WrapErrf(err, "failed to call server reflection")
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			return errs.NewErrf("server reflection failed, %v", e.GetErrorMessage())
+		}
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var fdp descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(b, &fdp); err != nil {
+				return errs.WrapErrf(err, "invalid file descriptor returned by server reflection")
+			}
+			fdps[fdp.GetName()] = &fdp
+		}
+		return nil
+	}
+
+	err = fetch(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: svc}})
+	if err != nil {
+		return nil, err
+	}
+	return buildFiles(fdps, func(name string) error {
+		return fetch(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name}})
+	})
+}
+
+// build files from the file descriptors, missing dependencies are fetched (optional) or resolved from the global registry.
+func buildFiles(fdps map[string]*descriptorpb.FileDescriptorProto, fetch func(name string) error) (*protoregistry.Files, error) {
+	for resolved := false; !resolved; {
+		resolved = true
+		for _, fdp := range fdps {
+			for _, dep := range fdp.GetDependency() {
+				if _, ok := fdps[dep]; ok {
+					continue
+				}
+				resolved = false
+				if fetch != nil {
+					if err := fetch(dep); err == nil {
+						if _, ok := fdps[dep]; ok {
+							continue
+						}
+					}
+				}
+				fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+				if err != nil {
+					return nil, errs.NewErrf("proto file '%v' imported by '%v' not found", dep, fdp.GetName())
+				}
+				fdps[dep] = protodesc.ToFileDescriptorProto(fd)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{File: make([]*descriptorpb.FileDescriptorProto, 0, len(fdps))}
+	for _, fdp := range fdps {
+		set.File = append(set.File, fdp)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "invalid proto file descriptors")
+	}
+	return files, nil
+}
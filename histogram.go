@@ -0,0 +1,152 @@
+package benchmarker
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// number of bits used for the sub-buckets, the relative error of recorded values is at most 1/2^(histSubBucketBits-1), i.e., ~0.2%.
+	histSubBucketBits  = 10
+	histSubBucketCount = 1 << histSubBucketBits
+	histSubBucketHalf  = histSubBucketCount / 2
+)
+
+// HDR-style (log-linear) histogram of durations.
+//
+// Values are recorded in buckets with bounded relative error, memory usage only grows with the magnitude of the max value,
+// not the number of values recorded. Min, Max and Mean are exact.
+//
+// Histogram is not thread-safe.
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, histSubBucketCount)}
+}
+
+func histIndex(v int64) int {
+	if v < histSubBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBucketBits
+	sub := v >> shift
+	return histSubBucketCount + (shift-1)*histSubBucketHalf + int(sub-histSubBucketHalf)
+}
+
+// highest value that is equivalent to values in the bucket.
+func histValue(idx int) int64 {
+	if idx < histSubBucketCount {
+		return int64(idx)
+	}
+	shift := (idx-histSubBucketCount)/histSubBucketHalf + 1
+	sub := int64((idx-histSubBucketCount)%histSubBucketHalf + histSubBucketHalf)
+	return (sub+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := histIndex(int64(d))
+	if i >= len(h.counts) {
+		grown := make([]int64, i+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[i]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+// Merge all values recorded in o into h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		grown := make([]int64, len(o.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+func (h *Histogram) Count() int {
+	return int(h.total)
+}
+
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Value at the given percentile (0-100).
+func (h *Histogram) ValueAtPercentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := h.percentileRank(p) + 1
+	var acc int64
+	for i, c := range h.counts {
+		acc += c
+		if acc >= rank {
+			return min(max(time.Duration(histValue(i)), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// index of the value at the given percentile if all values are sorted, same as func percentile(...).
+func (h *Histogram) percentileRank(p float64) int64 {
+	return max(int64(math.Ceil(p/100.0*float64(h.total)))-1, 0)
+}
+
+func (h *Histogram) latencyStats() LatencyStats {
+	st := LatencyStats{
+		Count:       h.Count(),
+		Min:         h.Min(),
+		Max:         h.Max(),
+		Avg:         h.Mean(),
+		Med:         h.ValueAtPercentile(50),
+		Percentiles: map[int]time.Duration{},
+	}
+	if h.total > 0 {
+		for _, pv := range percentileValues {
+			st.Percentiles[pv] = h.ValueAtPercentile(float64(pv))
+		}
+	}
+	return st
+}
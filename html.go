@@ -0,0 +1,434 @@
+package benchmarker
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	// max number of points of each series in html report charts, records are downsampled if necessary.
+	htmlMaxChartPoints = 2000
+)
+
+var (
+	htmlReportTmpl = template.Must(template.New("report").Parse(htmlReportTmplStr))
+)
+
+type htmlKV struct {
+	Key   string
+	Value string
+}
+
+type htmlSeries struct {
+	Name   string      `json:"name"`
+	Points [][]float64 `json:"points"` // [[x, y], ...]
+}
+
+type htmlChart struct {
+	Id     string       `json:"id"`
+	Title  string       `json:"title"`
+	XLabel string       `json:"xLabel"`
+	YLabel string       `json:"yLabel"`
+	Series []htmlSeries `json:"series"`
+}
+
+type htmlPercentileRow struct {
+	Name   string
+	Values []string
+}
+
+type htmlThresholdRow struct {
+	Pass      bool
+	Threshold string
+	Actual    string
+}
+
+type htmlScenarioRow struct {
+	Name       string
+	Weight     int
+	Requests   int
+	Throughput string
+	ErrorRate  string
+}
+
+type htmlReport struct {
+	Title           string
+	Summary         []htmlKV
+	Config          []htmlKV
+	StatusCount     []htmlKV
+	SuccessCount    []htmlKV
+	Scenarios       []htmlScenarioRow
+	PercentileNames []string
+	Percentiles     []htmlPercentileRow
+	Thresholds      []htmlThresholdRow
+	Charts          []htmlChart
+	ChartsOmitted   bool
+	Extra           []string
+}
+
+// write self-contained html report, bench is sorted by timestamp.
+func writeHtmlReport(spec BenchmarkSpec, stats Stats, bench []Benchmark) error {
+	return writeFile(spec.HtmlReportFilename, func(w io.Writer) error {
+		return renderHtmlReport(w, spec, stats, bench)
+	})
+}
+
+func renderHtmlReport(w io.Writer, spec BenchmarkSpec, stats Stats, bench []Benchmark) error {
+	r := htmlReport{
+		Title: "Benchmark Report - " + spec.benchmarkTime,
+		Summary: []htmlKV{
+			{"Total Time", stats.TotalTime.String()},
+			{"Total Requests", cast.ToString(stats.TotalRequests)},
+			{"Throughput", fmt.Sprintf("%.0f req/sec", stats.Throughput)},
+			{"Error Rate", fmt.Sprintf("%.2f%%", stats.ErrorRate()*100)},
+		},
+		Config: htmlRunConfig(spec),
+		Extra:  stats.ExtraOutput,
+	}
+	if stats.Interrupted {
+		r.Title += " (Interrupted)"
+		r.Summary = append([]htmlKV{{"Interrupted", "true (partial results)"}}, r.Summary...)
+	}
+	if ws := stats.WebSocket; ws != nil {
+		r.Summary = append(r.Summary,
+			htmlKV{"Connections", fmt.Sprintf("%d (failed: %d)", ws.Connections, ws.FailedConnections)},
+			htmlKV{"Messages", fmt.Sprintf("sent: %d, received: %d, dropped: %d, failed: %d, unmatched: %d",
+				ws.Sent, ws.Received, ws.Dropped, ws.Failed, ws.Unmatched)},
+		)
+	}
+
+	statusKeys := make([]int, 0, len(stats.StatusCount))
+	for k := range stats.StatusCount {
+		statusKeys = append(statusKeys, k)
+	}
+	sort.Ints(statusKeys)
+	for _, k := range statusKeys {
+		r.StatusCount = append(r.StatusCount, htmlKV{cast.ToString(k), cast.ToString(stats.StatusCount[k])})
+	}
+	for _, k := range []bool{true, false} {
+		if v, ok := stats.SuccessCount[k]; ok {
+			r.SuccessCount = append(r.SuccessCount, htmlKV{cast.ToString(k), cast.ToString(v)})
+		}
+	}
+
+	r.PercentileNames = []string{"Min", "Max", "Avg", "Median"}
+	for _, pv := range percentileValues {
+		r.PercentileNames = append(r.PercentileNames, fmt.Sprintf("P%d", pv))
+	}
+	latency := htmlPercentileRow{Name: "latency", Values: []string{stats.Min.String(), stats.Max.String(), stats.Avg.String(), stats.Med.String()}}
+	for _, pv := range percentileValues {
+		latency.Values = append(latency.Values, stats.Percentiles[pv].Record.Took.String())
+	}
+	r.Percentiles = append(r.Percentiles, latency)
+	if stats.Corrected != nil {
+		r.Percentiles = append(r.Percentiles, htmlLatencyRow("corrected_latency", *stats.Corrected))
+	}
+	for _, p := range timingPhases {
+		if ps, ok := stats.Phases[p.Name]; ok && ps.Count > 0 {
+			r.Percentiles = append(r.Percentiles, htmlLatencyRow(p.Name, ps))
+		}
+	}
+	if ws := stats.WebSocket; ws != nil && ws.Connect.Count > 0 {
+		r.Percentiles = append(r.Percentiles, htmlLatencyRow("ws_connect", ws.Connect))
+	}
+	for _, sc := range spec.Scenarios {
+		ss := stats.Scenarios[sc.Name]
+		r.Scenarios = append(r.Scenarios, htmlScenarioRow{
+			Name:       sc.Name,
+			Weight:     sc.Weight,
+			Requests:   ss.TotalRequests,
+			Throughput: fmt.Sprintf("%.0f req/sec", ss.Throughput),
+			ErrorRate:  fmt.Sprintf("%.2f%%", ss.ErrorRate()*100),
+		})
+		r.Percentiles = append(r.Percentiles, htmlLatencyRow("latency["+sc.Name+"]", ss.latencyStats()))
+		if ss.Corrected != nil {
+			r.Percentiles = append(r.Percentiles, htmlLatencyRow("corrected_latency["+sc.Name+"]", *ss.Corrected))
+		}
+		if ss.Journey != nil {
+			r.Percentiles = append(r.Percentiles, htmlLatencyRow("journey_latency["+sc.Name+"]", ss.Journey.LatencyStats))
+		}
+		for _, st := range sc.Steps {
+			ps := ss.Steps[st.Name]
+			r.Percentiles = append(r.Percentiles, htmlLatencyRow("latency["+sc.Name+"/"+st.Name+"]", ps.latencyStats()))
+		}
+	}
+
+	for _, t := range stats.Thresholds {
+		actual := "n/a"
+		if t.Available {
+			actual = t.Threshold.formatValue(t.Actual)
+		}
+		r.Thresholds = append(r.Thresholds, htmlThresholdRow{Pass: t.Pass, Threshold: t.Threshold.Expr, Actual: actual})
+	}
+
+	if len(bench) > 0 {
+		r.Charts = htmlCharts(spec, stats, bench)
+	} else {
+		r.ChartsOmitted = true
+	}
+	return htmlReportTmpl.Execute(w, r)
+}
+
+func htmlLatencyRow(name string, ls LatencyStats) htmlPercentileRow {
+	row := htmlPercentileRow{Name: name, Values: []string{ls.Min.String(), ls.Max.String(), ls.Avg.String(), ls.Med.String()}}
+	for _, pv := range percentileValues {
+		row.Values = append(row.Values, ls.Percentiles[pv].String())
+	}
+	return row
+}
+
+func htmlRunConfig(spec BenchmarkSpec) []htmlKV {
+	c := []htmlKV{{"Benchmark Time", spec.benchmarkTime}}
+	if spec.Rate > 0 {
+		c = append(c, htmlKV{"Rate", fmt.Sprintf("%v req/sec", spec.Rate)})
+	}
+	if spec.Rate > 0 && spec.WebSocket == nil {
+		c = append(c, htmlKV{"Max Workers", cast.ToString(spec.MaxWorkers)})
+	} else {
+		c = append(c, htmlKV{"Concurrency", cast.ToString(spec.Concurrent)})
+	}
+	if len(spec.Stages) > 0 {
+		c = append(c, htmlKV{"Stages", fmt.Sprintf("%v", spec.Stages)})
+	}
+	if spec.Duration > 0 {
+		c = append(c, htmlKV{"Duration", spec.Duration.String()})
+	} else {
+		c = append(c, htmlKV{"Rounds", cast.ToString(spec.Round)})
+	}
+	if spec.Assert != "" {
+		c = append(c, htmlKV{"Assert", spec.Assert})
+	}
+	if ws := spec.WebSocket; ws != nil {
+		c = append(c, htmlKV{"WebSocket", ws.Url})
+	}
+	c = append(c, htmlKV{"Stream Stats", cast.ToString(spec.StreamStats)})
+	if !spec.DisableOutputFile {
+		c = append(c, htmlKV{"Data File", spec.DataOutputFilename})
+	}
+	return c
+}
+
+func htmlCharts(spec BenchmarkSpec, stats Stats, bench []Benchmark) []htmlChart {
+	took := func(b *Benchmark) float64 { return durMs(b.Took) }
+	latency := htmlChart{Id: "latency", Title: "Request Latency", XLabel: "Request (sorted by timestamp)", YLabel: "Latency (ms)"}
+	latency.Series = append(latency.Series,
+		htmlSeries{Name: "avg", Points: downsample(bench, nil, took, false)},
+		htmlSeries{Name: "max", Points: downsample(bench, nil, took, true)},
+	)
+	if stats.Corrected != nil {
+		latency.Series = append(latency.Series,
+			htmlSeries{Name: "corrected max", Points: downsample(bench, nil, func(b *Benchmark) float64 { return durMs(b.CorrectedTook) }, true)})
+	}
+
+	successRate := htmlChart{Id: "success-rate", Title: "Success Rate", XLabel: "Request (sorted by timestamp)", YLabel: "Success Rate (%)"}
+	successRate.Series = append(successRate.Series,
+		htmlSeries{Name: "success rate", Points: downsample(bench, nil, func(b *Benchmark) float64 { return b.successRate * 100 }, false)})
+
+	throughput := htmlChart{Id: "throughput", Title: "Throughput", XLabel: "Seconds Since Start", YLabel: "Requests / Sec"}
+	throughput.Series = append(throughput.Series, htmlSeries{Name: "throughput", Points: throughputPerSecond(bench, nil)})
+
+	for _, sc := range spec.Scenarios {
+		name := sc.Name
+		inScenario := func(b *Benchmark) bool { return b.Scenario == name }
+		latency.Series = append(latency.Series, htmlSeries{Name: "avg [" + name + "]", Points: downsample(bench, inScenario, took, false)})
+		throughput.Series = append(throughput.Series, htmlSeries{Name: name, Points: throughputPerSecond(bench, inScenario)})
+	}
+
+	return []htmlChart{latency, throughput, successRate}
+}
+
+// downsample values of the records (sorted by timestamp) into at most htmlMaxChartPoints points, using avg or max of each chunk.
+//
+// Only records matching the filter (nil means all) are included, x of each point is the index of the chunk's first record in bench.
+func downsample(bench []Benchmark, filter func(b *Benchmark) bool, value func(b *Benchmark) float64, useMax bool) [][]float64 {
+	idx := make([]int, 0, len(bench))
+	for i := range bench {
+		if filter == nil || filter(&bench[i]) {
+			idx = append(idx, i)
+		}
+	}
+	chunk := max(int(math.Ceil(float64(len(idx))/htmlMaxChartPoints)), 1)
+	pts := make([][]float64, 0, min(len(idx), htmlMaxChartPoints))
+	for i := 0; i < len(idx); i += chunk {
+		end := min(i+chunk, len(idx))
+		var v float64
+		for _, j := range idx[i:end] {
+			if useMax {
+				v = max(v, value(&bench[j]))
+			} else {
+				v += value(&bench[j])
+			}
+		}
+		if !useMax {
+			v = v / float64(end-i)
+		}
+		pts = append(pts, []float64{float64(idx[i]), math.Round(v*1000) / 1000})
+	}
+	return pts
+}
+
+// number of requests (matching the filter, nil means all) sent in each second, bench is sorted by timestamp.
+func throughputPerSecond(bench []Benchmark, filter func(b *Benchmark) bool) [][]float64 {
+	if len(bench) < 1 {
+		return nil
+	}
+	start := bench[0].Timestamp
+	end := bench[len(bench)-1].Timestamp
+	counts := make([]float64, int((end-start)/int64(time.Second/time.Microsecond))+1)
+	for i := range bench {
+		b := &bench[i]
+		if filter != nil && !filter(b) {
+			continue
+		}
+		sec := int((b.Timestamp - start) / int64(time.Second/time.Microsecond))
+		counts[sec]++
+	}
+	pts := make([][]float64, 0, len(counts))
+	for i, c := range counts {
+		pts = append(pts, []float64{float64(i), c})
+	}
+	return pts
+}
+
+func durMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+const htmlReportTmplStr = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 22px; }
+h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+table { border-collapse: collapse; margin: 8px 0; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: left; font-size: 13px; }
+th { background: #f5f5f5; }
+.row { display: flex; gap: 32px; flex-wrap: wrap; }
+.chart { position: relative; margin: 16px 0; }
+.chart svg { border: 1px solid #eee; }
+.tooltip { position: absolute; pointer-events: none; background: rgba(0,0,0,0.75); color: #fff; padding: 4px 6px; font-size: 12px; border-radius: 3px; display: none; white-space: nowrap; }
+.pass { color: #2e7d32; font-weight: bold; }
+.fail { color: #c62828; font-weight: bold; }
+pre { background: #f7f7f7; padding: 8px; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+
+<h2>Summary</h2>
+<div class="row">
+<table>{{range .Summary}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+<table><tr><th>Status</th><th>Count</th></tr>{{range .StatusCount}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+<table><tr><th>Success</th><th>Count</th></tr>{{range .SuccessCount}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</div>
+{{if .Scenarios}}<table>
+<tr><th>Scenario</th><th>Weight</th><th>Requests</th><th>Throughput</th><th>Error Rate</th></tr>
+{{range .Scenarios}}<tr><th>{{.Name}}</th><td>{{.Weight}}</td><td>{{.Requests}}</td><td>{{.Throughput}}</td><td>{{.ErrorRate}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Latency</h2>
+<table>
+<tr><th></th>{{range .PercentileNames}}<th>{{.}}</th>{{end}}</tr>
+{{range .Percentiles}}<tr><th>{{.Name}}</th>{{range .Values}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+{{if .Thresholds}}<h2>Thresholds</h2>
+<table>
+<tr><th>Result</th><th>Threshold</th><th>Actual</th></tr>
+{{range .Thresholds}}<tr><td>{{if .Pass}}<span class="pass">PASS</span>{{else}}<span class="fail">FAIL</span>{{end}}</td><td>{{.Threshold}}</td><td>{{.Actual}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Charts</h2>
+{{if .ChartsOmitted}}<p>Charts are not available, records are not retained.</p>{{end}}
+{{range .Charts}}<div class="chart" id="{{.Id}}"></div>
+{{end}}
+
+<h2>Run Configuration</h2>
+<table>{{range .Config}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+
+{{if .Extra}}<h2>Extra</h2>
+{{range .Extra}}<pre>{{.}}</pre>
+{{end}}{{end}}
+
+<script>
+const charts = {{.Charts}};
+const colors = ["#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324", "#469990", "#808000"];
+const NS = "http://www.w3.org/2000/svg";
+
+function el(name, attrs, parent) {
+	const e = document.createElementNS(NS, name);
+	for (const k in attrs) e.setAttribute(k, attrs[k]);
+	if (parent) parent.appendChild(e);
+	return e;
+}
+
+function drawChart(c) {
+	const root = document.getElementById(c.id);
+	const W = 1100, H = 360, L = 60, R = 20, T = 30, B = 40;
+	let minX = Infinity, maxX = -Infinity, maxY = 0;
+	c.series.forEach(s => (s.points || []).forEach(p => {
+		minX = Math.min(minX, p[0]); maxX = Math.max(maxX, p[0]); maxY = Math.max(maxY, p[1]);
+	}));
+	if (!isFinite(minX)) return;
+	if (maxX === minX) maxX = minX + 1;
+	if (maxY === 0) maxY = 1;
+	maxY *= 1.05;
+	const sx = x => L + (x - minX) / (maxX - minX) * (W - L - R);
+	const sy = y => H - B - y / maxY * (H - T - B);
+
+	const svg = el("svg", {width: W, height: H}, root);
+	el("text", {x: W / 2, y: 18, "text-anchor": "middle", "font-size": 14}, svg).textContent = c.title;
+	el("text", {x: W / 2, y: H - 6, "text-anchor": "middle", "font-size": 12}, svg).textContent = c.xLabel;
+	el("text", {x: 14, y: H / 2, "text-anchor": "middle", "font-size": 12, transform: "rotate(-90 14 " + H / 2 + ")"}, svg).textContent = c.yLabel;
+	for (let i = 0; i <= 5; i++) {
+		const y = maxY / 5 * i;
+		el("line", {x1: L, x2: W - R, y1: sy(y), y2: sy(y), stroke: "#eee"}, svg);
+		el("text", {x: L - 4, y: sy(y) + 4, "text-anchor": "end", "font-size": 11}, svg).textContent = y.toFixed(y < 10 ? 2 : 0);
+		const x = minX + (maxX - minX) / 5 * i;
+		el("text", {x: sx(x), y: H - B + 14, "text-anchor": "middle", "font-size": 11}, svg).textContent = Math.round(x);
+	}
+	c.series.forEach((s, i) => {
+		const pts = (s.points || []).map(p => sx(p[0]) + "," + sy(p[1])).join(" ");
+		el("polyline", {points: pts, fill: "none", stroke: colors[i % colors.length], "stroke-width": 1.2}, svg);
+		const perRow = Math.floor((W - L - R) / 140), lx = L + 10 + (i % perRow) * 140, ly = T - 6 + Math.floor(i / perRow) * 14;
+		el("rect", {x: lx, y: ly, width: 10, height: 10, fill: colors[i % colors.length]}, svg);
+		el("text", {x: lx + 14, y: ly + 9, "font-size": 11}, svg).textContent = s.name;
+	});
+
+	const cursor = el("line", {y1: T, y2: H - B, stroke: "#999", "stroke-dasharray": "3,3", visibility: "hidden"}, svg);
+	const tip = document.createElement("div");
+	tip.className = "tooltip";
+	root.appendChild(tip);
+	svg.addEventListener("mousemove", e => {
+		const rect = svg.getBoundingClientRect();
+		const px = e.clientX - rect.left;
+		const x = minX + (px - L) / (W - L - R) * (maxX - minX);
+		const lines = [];
+		let cx = null;
+		c.series.forEach(s => {
+			let best = null;
+			(s.points || []).forEach(p => { if (best === null || Math.abs(p[0] - x) < Math.abs(best[0] - x)) best = p; });
+			if (best) { lines.push(s.name + ": " + best[1]); cx = best[0]; }
+		});
+		if (cx === null) return;
+		cursor.setAttribute("x1", sx(cx)); cursor.setAttribute("x2", sx(cx)); cursor.setAttribute("visibility", "visible");
+		tip.innerText = c.xLabel + ": " + cx + "\n" + lines.join("\n");
+		tip.style.left = (px + 12) + "px"; tip.style.top = (e.clientY - rect.top + 12) + "px"; tip.style.display = "block";
+	});
+	svg.addEventListener("mouseleave", () => { tip.style.display = "none"; cursor.setAttribute("visibility", "hidden"); });
+}
+
+(charts || []).forEach(drawChart);
+</script>
+</body>
+</html>
+`
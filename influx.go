@@ -0,0 +1,130 @@
+package benchmarker
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	defInfluxMeasurement = "benchmarker"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Spec of InfluxSink.
+type InfluxSinkSpec struct {
+	// write endpoint, precision must be ns, e.g., 'http://localhost:8086/api/v2/write?org=myorg&bucket=mybucket&precision=ns'
+	// (v2) or 'http://localhost:8086/write?db=mydb&precision=ns' (v1).
+	Url string
+
+	// optional, api token, sent as 'Authorization: Token {token}'.
+	Token string
+
+	// optional, name of the measurement, by default 'benchmarker'.
+	Measurement string
+
+	// optional, extra tags added to every point, e.g., {"env": "staging"}.
+	Tags map[string]string
+
+	// optional, by default, a client with 10s timeout is used.
+	Client *http.Client
+}
+
+// Sink that writes one point per request in InfluxDB line protocol over http.
+//
+// Tags: status, success, scenario and step (if they are not empty), fields: took_ns and corrected_took_ns.
+//
+// Points are timestamped with the send time in ns, send times are unique across the records (i.e., two requests sent in the
+// same microsecond are a few ns apart), so that points of the same series never overwrite each other.
+type InfluxSink struct {
+	spec InfluxSinkSpec
+	tags string // escaped extra tags, sorted by key
+}
+
+func NewInfluxSink(spec InfluxSinkSpec) (*InfluxSink, error) {
+	if spec.Url == "" {
+		return nil, errs.NewErrf("InfluxDB write url is empty")
+	}
+	if spec.Measurement == "" {
+		spec.Measurement = defInfluxMeasurement
+	}
+	if spec.Client == nil {
+		spec.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	keys := make([]string, 0, len(spec.Tags))
+	for k, v := range spec.Tags {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	sb := strings.Builder{}
+	for _, k := range keys {
+		sb.WriteString("," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(spec.Tags[k]))
+	}
+	return &InfluxSink{spec: spec, tags: sb.String()}, nil
+}
+
+func (s *InfluxSink) Name() string {
+	return "influxdb"
+}
+
+func (s *InfluxSink) Write(batch []Benchmark) error {
+	var buf bytes.Buffer
+	for i := range batch {
+		s.appendLine(&buf, &batch[i])
+	}
+	req, err := http.NewRequest(http.MethodPost, s.spec.Url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.spec.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.spec.Token)
+	}
+	res, err := s.spec.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errs.NewErrf("InfluxDB responded %v, %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+// e.g., 'benchmarker,status=200,success=true took_ns=1200000i,corrected_took_ns=1200000i 1700000000000000000'
+func (s *InfluxSink) appendLine(buf *bytes.Buffer, b *Benchmark) {
+	buf.WriteString(influxMeasurementEscaper.Replace(s.spec.Measurement))
+	buf.WriteString(",status=" + strconv.Itoa(b.HttpStatus))
+	buf.WriteString(",success=" + strconv.FormatBool(b.Success))
+	if b.Scenario != "" {
+		buf.WriteString(",scenario=" + influxTagEscaper.Replace(b.Scenario))
+	}
+	if b.Step != "" {
+		buf.WriteString(",step=" + influxTagEscaper.Replace(b.Step))
+	}
+	buf.WriteString(s.tags)
+	buf.WriteString(" took_ns=" + strconv.FormatInt(int64(b.Took), 10) + "i")
+	buf.WriteString(",corrected_took_ns=" + strconv.FormatInt(int64(b.CorrectedTook), 10) + "i")
+	ts := b.sentUnixNano
+	if ts == 0 { // not sent by the workers, e.g., records built by hand
+		ts = b.Timestamp * int64(time.Microsecond)
+	}
+	buf.WriteString(" " + strconv.FormatInt(ts, 10) + "\n")
+}
+
+func (s *InfluxSink) Flush() error {
+	return nil
+}
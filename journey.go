@@ -0,0 +1,378 @@
+package benchmarker
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	// extract value from json response body by path, e.g., 'data.token', 'data.items[0].id'.
+	ExtractFromJson = "json"
+
+	// extract value from response header by name, e.g., 'X-Order-Id'.
+	ExtractFromHeader = "header"
+
+	// extract value from response body by regex, the first capturing group is extracted (or the whole match if there is no group).
+	ExtractFromRegex = "regex"
+)
+
+// func to build request of a journey step, vars contains values extracted from previous responses of the same journey,
+// it's reset at the start of each journey.
+type BuildStepRequestFunc func(vars map[string]any) (*http.Request, error)
+
+// Step of a journey (Scenario.Steps), e.g., login, create order, fetch order by id.
+type JourneyStep struct {
+	// required, unique name of the step in the journey, requests are tagged with it (Benchmark.Step).
+	Name string
+
+	// required, func to build request of the step.
+	BuildReqFunc BuildStepRequestFunc
+
+	// optional, by default Scenario.ParseResFunc is used.
+	ParseResFunc ParseResponseFunc
+
+	// optional, values extracted from the response into the variable bag of the virtual user, the step fails if any value is missing.
+	Extract []Extractor
+
+	extractors []compiledExtractor
+}
+
+// Extractor extracts value from the response into variable Var.
+type Extractor struct {
+	Var  string `json:"var"`
+	From string `json:"from"` // ExtractFromJson (default), ExtractFromHeader or ExtractFromRegex
+	Path string `json:"path"` // json path, header name or regex
+}
+
+type compiledExtractor struct {
+	Extractor
+	jsonPath []any // string for object key, int for array index
+	regex    *regexp.Regexp
+}
+
+// Stats of whole journeys, i.e., from the first step is sent until the last step is completed.
+type JourneyStats struct {
+	LatencyStats
+	SuccessCount map[bool]int
+	Throughput   float64 // journeys/sec
+}
+
+// Journey in the journey file (json), it's loaded as a Scenario, e.g.,
+//
+//	{
+//	  "name": "order",
+//	  "steps": [
+//	    {"name": "login", "method": "POST", "url": "http://localhost:8080/login", "body": {"user": "abc"},
+//	      "extract": [{"var": "token", "from": "json", "path": "data.token"}]},
+//	    {"name": "create", "method": "POST", "url": "http://localhost:8080/order", "header_expr": "{\"x-token\": vars.token}",
+//	      "extract": [{"var": "orderId", "from": "json", "path": "data.orderId"}]},
+//	    {"name": "fetch", "url_expr": "'http://localhost:8080/order/' + vars.orderId", "header_expr": "{\"x-token\": vars.token}"}
+//	  ]
+//	}
+//
+// Expr templates (url_expr, header_expr and body_expr) can reference extracted values via 'vars'.
+type JourneyFile struct {
+	Name   string            `json:"name"`
+	Weight int               `json:"weight"` // by default 1
+	Steps  []JourneyFileStep `json:"steps"`
+}
+
+type JourneyFileStep struct {
+	Name string `json:"name"`
+	ReplayRequest
+	Extract []Extractor `json:"extract"`
+}
+
+// Load journey file as a Scenario.
+func LoadJourney(file string) (Scenario, error) {
+	buf, err := util.ReadFileAll(file)
+	if err != nil {
+		return Scenario{}, errs.WrapErrf(err, "failed to read journey file '%v'", file)
+	}
+	var jf JourneyFile
+	if err := json.ParseJson(buf, &jf); err != nil {
+		return Scenario{}, errs.WrapErrf(err, "invalid journey file '%v'", file)
+	}
+	return NewJourney(jf)
+}
+
+// Create journey Scenario from JourneyFile.
+func NewJourney(jf JourneyFile) (Scenario, error) {
+	s := Scenario{Name: jf.Name, Weight: jf.Weight, Steps: make([]JourneyStep, 0, len(jf.Steps))}
+	if s.Weight < 1 {
+		s.Weight = 1
+	}
+	if len(jf.Steps) < 1 {
+		return s, errs.NewErrf("Journey '%v' has no steps", jf.Name)
+	}
+
+	env := builtinExprEnv()
+	env["vars"] = map[string]any{}
+	for _, fs := range jf.Steps {
+		if fs.Url == "" && fs.UrlExpr == "" {
+			return s, errs.NewErrf("Invalid step '%v' of journey '%v', url is empty", fs.Name, jf.Name)
+		}
+		c, err := compileReplayRequest(fs.ReplayRequest, env)
+		if err != nil {
+			return s, errs.WrapErrf(err, "invalid step '%v' of journey '%v'", fs.Name, jf.Name)
+		}
+		s.Steps = append(s.Steps, JourneyStep{
+			Name:    fs.Name,
+			Extract: fs.Extract,
+			BuildReqFunc: func(vars map[string]any) (*http.Request, error) {
+				env := builtinExprEnv()
+				env["vars"] = vars
+				return c.build(env)
+			},
+		})
+	}
+	return s, nil
+}
+
+// validate steps and fill default values, a copy of the steps is returned.
+func prepareSteps(s *Scenario) ([]JourneyStep, error) {
+	steps := slices.Clone(s.Steps)
+	names := make(map[string]struct{}, len(steps))
+	for i := range steps {
+		st := &steps[i]
+		if st.Name == "" {
+			return nil, errs.NewErrf("Step name of scenario '%v' is required", s.Name)
+		}
+		if _, ok := names[st.Name]; ok {
+			return nil, errs.NewErrf("Duplicate step name '%v' in scenario '%v'", st.Name, s.Name)
+		}
+		names[st.Name] = struct{}{}
+		if st.BuildReqFunc == nil {
+			return nil, errs.NewErrf("BuildReqFunc of step '%v' in scenario '%v' is required", st.Name, s.Name)
+		}
+		if st.ParseResFunc == nil {
+			st.ParseResFunc = s.ParseResFunc
+		}
+		st.extractors = make([]compiledExtractor, 0, len(st.Extract))
+		for _, e := range st.Extract {
+			ce, err := compileExtractor(e)
+			if err != nil {
+				return nil, errs.WrapErrf(err, "invalid extractor of step '%v' in scenario '%v'", st.Name, s.Name)
+			}
+			st.extractors = append(st.extractors, ce)
+		}
+	}
+	return steps, nil
+}
+
+func compileExtractor(e Extractor) (compiledExtractor, error) {
+	ce := compiledExtractor{Extractor: e}
+	if ce.From == "" {
+		ce.From = ExtractFromJson
+	}
+	if ce.Var == "" {
+		return ce, errs.NewErrf("Extractor var is required")
+	}
+	switch ce.From {
+	case ExtractFromJson:
+		p, err := parseJsonPath(ce.Path)
+		if err != nil {
+			return ce, err
+		}
+		ce.jsonPath = p
+	case ExtractFromHeader:
+		if ce.Path == "" {
+			return ce, errs.NewErrf("Header name of extractor '%v' is required", ce.Var)
+		}
+	case ExtractFromRegex:
+		re, err := regexp.Compile(ce.Path)
+		if err != nil {
+			return ce, errs.WrapErrf(err, "invalid regex of extractor '%v'", ce.Var)
+		}
+		ce.regex = re
+	default:
+		return ce, errs.NewErrf("Invalid extractor source '%v', must be one of json, header and regex", ce.From)
+	}
+	return ce, nil
+}
+
+// parse json path, e.g., 'data.items[0].id' (or '$.data.items.0.id') is parsed as ["data", "items", 0, "id"].
+func parseJsonPath(path string) ([]any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, errs.NewErrf("Json path is empty")
+	}
+	var p []any
+	for _, seg := range strings.Split(path, ".") {
+		key, idx, _ := strings.Cut(seg, "[")
+		if key != "" {
+			p = append(p, key)
+		}
+		if idx == "" {
+			if key == "" {
+				return nil, errs.NewErrf("Invalid json path '%v'", path)
+			}
+			continue
+		}
+		for _, s := range strings.Split(idx, "[") {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, "]"))
+			if err != nil || !strings.HasSuffix(s, "]") {
+				return nil, errs.NewErrf("Invalid json path '%v'", path)
+			}
+			p = append(p, n)
+		}
+	}
+	return p, nil
+}
+
+func lookupJsonPath(v any, path []any) (any, bool) {
+	for _, k := range path {
+		switch t := v.(type) {
+		case map[string]any:
+			key, ok := k.(string)
+			if !ok {
+				key = strconv.Itoa(k.(int))
+			}
+			if v, ok = t[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, ok := k.(int)
+			if !ok {
+				n, err := strconv.Atoi(k.(string))
+				if err != nil {
+					return nil, false
+				}
+				i = n
+			}
+			if i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+// extract values from the response into vars.
+func (st *JourneyStep) extract(res *http.Response, buf []byte, vars map[string]any) error {
+	var (
+		body   any
+		parsed bool
+	)
+	for _, e := range st.extractors {
+		switch e.From {
+		case ExtractFromJson:
+			if !parsed {
+				parsed = true
+				if err := json.ParseJson(buf, &body); err != nil {
+					return errs.WrapErrf(err, "failed to extract '%v', response is not json", e.Var)
+				}
+			}
+			v, ok := lookupJsonPath(body, e.jsonPath)
+			if !ok {
+				return errs.NewErrf("failed to extract '%v', json path '%v' not found", e.Var, e.Path)
+			}
+			vars[e.Var] = v
+		case ExtractFromHeader:
+			v := res.Header.Get(e.Path)
+			if v == "" {
+				return errs.NewErrf("failed to extract '%v', header '%v' not found", e.Var, e.Path)
+			}
+			vars[e.Var] = v
+		case ExtractFromRegex:
+			m := e.regex.FindSubmatch(buf)
+			if m == nil {
+				return errs.NewErrf("failed to extract '%v', regex '%v' not matched", e.Var, e.Path)
+			}
+			if len(m) > 1 {
+				vars[e.Var] = string(m[1])
+			} else {
+				vars[e.Var] = string(m[0])
+			}
+		}
+	}
+	return nil
+}
+
+// run steps of the journey in order, the rest of the steps are skipped if any step fails.
+//
+// The last step sent is tagged with the whole journey latency (Benchmark.JourneyTook), results are not recorded if record is false.
+func (w *worker) runJourney(s *Scenario, intended time.Time, record bool) error {
+	start := time.Now()
+	clear(w.vars) // values extracted by previous journeys must not leak into this one
+	for i := range s.Steps {
+		st := &s.Steps[i]
+		buildReq := func() (*http.Request, error) { return st.BuildReqFunc(w.vars) }
+		afterRes := func(res *http.Response, buf []byte, r *Result) {
+			if w.spec.assertRes != nil {
+				w.spec.assertRes(res, buf, r)
+			}
+			if !r.Success {
+				return
+			}
+			if err := st.extract(res, buf, w.vars); err != nil {
+				r.Success = false
+				if r.Extra == nil {
+					r.Extra = map[string]any{}
+				}
+				r.Extra["ERROR"] = err.Error()
+			}
+		}
+		b, err := triggerOnce(w.spec.ctx, w.client, buildReq, st.ParseResFunc, afterRes, intended)
+		if err != nil {
+			return err // no more requests or interrupted
+		}
+		intended = time.Time{} // only the first step is scheduled
+
+		b.Scenario = s.Name
+		b.Step = st.Name
+		if !b.Success || i == len(s.Steps)-1 {
+			b.JourneyTook = time.Since(start)
+		}
+		if record {
+			w.record(&b)
+		}
+		if !b.Success {
+			break
+		}
+	}
+	return nil
+}
+
+// calculate stats of whole journeys, bench should only contain records of the journey.
+func computeJourneyStats(bench []Benchmark) *JourneyStats {
+	js := &JourneyStats{SuccessCount: map[bool]int{}}
+	took := make([]time.Duration, 0, len(bench))
+	for _, b := range bench {
+		if b.JourneyTook > 0 {
+			took = append(took, b.JourneyTook)
+			js.SuccessCount[b.Success]++
+		}
+	}
+	js.LatencyStats = durationStats(took)
+	return js
+}
+
+// calculate stats of each step, bench should only contain records of the journey.
+func computeStepStats(spec BenchmarkSpec, s *Scenario, bench []Benchmark) map[string]Stats {
+	groups := make(map[string][]Benchmark, len(s.Steps))
+	for _, st := range s.Steps {
+		groups[st.Name] = []Benchmark{}
+	}
+	for _, b := range bench {
+		if g, ok := groups[b.Step]; ok {
+			groups[b.Step] = append(g, b)
+		}
+	}
+	st := make(map[string]Stats, len(groups))
+	for name, g := range groups {
+		st[name] = computeStats(spec, g)
+	}
+	return st
+}
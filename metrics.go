@@ -0,0 +1,121 @@
+package benchmarker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsPath = "/metrics"
+
+	// how long the metrics endpoint keeps serving after the benchmark if BenchmarkSpec.MetricsLinger is not specified,
+	// it's the default scrape interval of Prometheus.
+	DefaultMetricsLinger = 15 * time.Second
+)
+
+var (
+	// buckets of latency histograms in seconds, from 0.5ms to 16s.
+	metricsLatencyBuckets = prometheus.ExponentialBuckets(0.0005, 2, 16)
+)
+
+// live metrics exposed in Prometheus exposition format, methods are no-op if it's nil.
+type liveMetrics struct {
+	requests  *prometheus.CounterVec
+	inFlight  prometheus.Gauge
+	latency   prometheus.Histogram
+	corrected prometheus.Histogram // only available in Rate mode
+	srv       *http.Server
+	linger    time.Duration
+}
+
+// start serving live metrics at BenchmarkSpec.MetricsAddr, nil is returned if it's not specified.
+func startMetrics(spec BenchmarkSpec) (*liveMetrics, error) {
+	if spec.MetricsAddr == "" {
+		return nil, nil
+	}
+	m := &liveMetrics{
+		linger: spec.MetricsLinger,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "benchmarker_requests_total",
+			Help: "Number of requests completed, by status code and success.",
+		}, []string{"status", "success"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "benchmarker_requests_in_flight",
+			Help: "Number of requests in flight (for WebSocket, messages waiting for reply).",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "benchmarker_request_duration_seconds",
+			Help:    "Latency of requests.",
+			Buckets: metricsLatencyBuckets,
+		}),
+	}
+	reg := prometheus.NewRegistry() // registered per run, so that the benchmark can be run multiple times
+	reg.MustRegister(m.requests, m.inFlight, m.latency)
+	if spec.Rate > 0 {
+		m.corrected = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "benchmarker_request_corrected_duration_seconds",
+			Help:    "Coordinated omission corrected latency of requests, measured from the scheduled send time.",
+			Buckets: metricsLatencyBuckets,
+		})
+		reg.MustRegister(m.corrected)
+	}
+
+	ln, err := net.Listen("tcp", spec.MetricsAddr)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "failed to listen on metrics address '%v'", spec.MetricsAddr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	m.srv = &http.Server{Handler: mux}
+	go func() {
+		if err := m.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.Printlnf("Metrics server exited, %v", err)
+		}
+	}()
+	util.Printlnf("Serving metrics at http://%v%v", ln.Addr(), metricsPath)
+	return m, nil
+}
+
+func (m *liveMetrics) observe(b *Benchmark) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(strconv.Itoa(b.HttpStatus), strconv.FormatBool(b.Success)).Inc()
+	m.latency.Observe(b.Took.Seconds())
+	if m.corrected != nil {
+		m.corrected.Observe(b.CorrectedTook.Seconds())
+	}
+}
+
+func (m *liveMetrics) addInFlight(n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.inFlight.Add(float64(n))
+}
+
+// stop serving the metrics after the linger, so that the final values can be scraped, the linger is cut short once ctx is done.
+func (m *liveMetrics) close(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	if m.linger > 0 {
+		util.Printlnf("Serving final metrics for %v", m.linger)
+		select {
+		case <-time.After(m.linger):
+		case <-ctx.Done():
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = m.srv.Shutdown(ctx)
+}
@@ -0,0 +1,278 @@
+package benchmarker
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	defOtlpServiceName = "benchmarker"
+
+	otlpTemporalityCumulative = 2
+)
+
+// Spec of OtlpSink.
+type OtlpSinkSpec struct {
+	// OTLP/HTTP metrics endpoint, e.g., 'http://localhost:4318/v1/metrics'.
+	Url string
+
+	// optional, extra http headers, e.g., for authentication.
+	Header http.Header
+
+	// optional, service.name of the resource, by default 'benchmarker'.
+	ServiceName string
+
+	// optional, extra resource attributes, e.g., {"env": "staging"}.
+	Attributes map[string]string
+
+	// optional, by default, a client with 10s timeout is used.
+	Client *http.Client
+}
+
+// Sink that exports metrics to OpenTelemetry collector over OTLP/HTTP (json encoding), one data point is exported per batch,
+// i.e., per BenchmarkSpec.SinkFlushInterval or BenchmarkSpec.SinkBatchSize records.
+//
+// Metrics (cumulative):
+//
+//   - benchmarker.requests: sum of requests, with attributes status and success.
+//   - benchmarker.request.duration: histogram of latency in seconds.
+//   - benchmarker.request.corrected_duration: histogram of coordinated omission corrected latency in seconds.
+type OtlpSink struct {
+	spec     OtlpSinkSpec
+	resource otlpResource
+	start    string
+
+	requests     map[otlpRequestKey]int64
+	latency      otlpHistogram
+	corrected    otlpHistogram
+	hasCorrected bool // corrected latency is only exported if it's different from the latency, i.e., in Rate mode
+}
+
+type otlpRequestKey struct {
+	status  int
+	success bool
+}
+
+type otlpHistogram struct {
+	count    uint64
+	sum      float64
+	min, max float64
+	buckets  []uint64 // len(metricsLatencyBuckets) + 1
+}
+
+func newOtlpHistogram() otlpHistogram {
+	return otlpHistogram{buckets: make([]uint64, len(metricsLatencyBuckets)+1)}
+}
+
+func (h *otlpHistogram) observe(v float64) {
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.buckets[sort.SearchFloat64s(metricsLatencyBuckets, v)]++ // upper bounds are inclusive
+}
+
+// OTLP json encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string             `json:"name"`
+	Unit      string             `json:"unit"`
+	Sum       *otlpSum           `json:"sum,omitempty"`
+	Histogram *otlpHistogramData `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsInt             string         `json:"asInt"`
+}
+
+type otlpHistogramData struct {
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogramDataPoint struct {
+	StartTimeUnixNano string    `json:"startTimeUnixNano"`
+	TimeUnixNano      string    `json:"timeUnixNano"`
+	Count             string    `json:"count"`
+	Sum               float64   `json:"sum"`
+	Min               float64   `json:"min"`
+	Max               float64   `json:"max"`
+	BucketCounts      []string  `json:"bucketCounts"`
+	ExplicitBounds    []float64 `json:"explicitBounds"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func NewOtlpSink(spec OtlpSinkSpec) (*OtlpSink, error) {
+	if spec.Url == "" {
+		return nil, errs.NewErrf("OTLP metrics endpoint is empty")
+	}
+	if spec.ServiceName == "" {
+		spec.ServiceName = defOtlpServiceName
+	}
+	if spec.Client == nil {
+		spec.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &OtlpSink{
+		spec:      spec,
+		start:     otlpTime(time.Now()),
+		requests:  map[otlpRequestKey]int64{},
+		latency:   newOtlpHistogram(),
+		corrected: newOtlpHistogram(),
+	}
+	s.resource.Attributes = append(s.resource.Attributes, otlpAttr("service.name", spec.ServiceName))
+	for _, k := range sortedKeys(spec.Attributes) {
+		s.resource.Attributes = append(s.resource.Attributes, otlpAttr(k, spec.Attributes[k]))
+	}
+	return s, nil
+}
+
+func (s *OtlpSink) Name() string {
+	return "otlp"
+}
+
+func (s *OtlpSink) Write(batch []Benchmark) error {
+	for i := range batch {
+		b := &batch[i]
+		s.requests[otlpRequestKey{status: b.HttpStatus, success: b.Success}]++
+		s.latency.observe(b.Took.Seconds())
+		s.corrected.observe(b.CorrectedTook.Seconds())
+		s.hasCorrected = s.hasCorrected || b.CorrectedTook != b.Took
+	}
+	// the state is cumulative, the next export still includes this batch even if this one fails
+	body, err := json.WriteJson(s.buildRequest(time.Now()))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.spec.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.spec.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.spec.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	rb, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errs.NewErrf("OTLP endpoint responded %v, %s", res.StatusCode, rb)
+	}
+	return nil
+}
+
+func (s *OtlpSink) buildRequest(now time.Time) otlpExportRequest {
+	ts := otlpTime(now)
+	keys := make([]otlpRequestKey, 0, len(s.requests))
+	for k := range s.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].status != keys[j].status {
+			return keys[i].status < keys[j].status
+		}
+		return !keys[i].success && keys[j].success
+	})
+	requests := &otlpSum{AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true}
+	for _, k := range keys {
+		requests.DataPoints = append(requests.DataPoints, otlpNumberDataPoint{
+			Attributes:        []otlpKeyValue{otlpAttr("status", strconv.Itoa(k.status)), otlpAttr("success", strconv.FormatBool(k.success))},
+			StartTimeUnixNano: s.start,
+			TimeUnixNano:      ts,
+			AsInt:             strconv.FormatInt(s.requests[k], 10),
+		})
+	}
+
+	metrics := []otlpMetric{
+		{Name: "benchmarker.requests", Unit: "{request}", Sum: requests},
+		{Name: "benchmarker.request.duration", Unit: "s", Histogram: s.histogramData(&s.latency, ts)},
+	}
+	if s.hasCorrected {
+		metrics = append(metrics, otlpMetric{Name: "benchmarker.request.corrected_duration", Unit: "s", Histogram: s.histogramData(&s.corrected, ts)})
+	}
+	return otlpExportRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     s.resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "benchmarker"}, Metrics: metrics}},
+	}}}
+}
+
+func (s *OtlpSink) histogramData(h *otlpHistogram, ts string) *otlpHistogramData {
+	dp := otlpHistogramDataPoint{
+		StartTimeUnixNano: s.start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatUint(h.count, 10),
+		Sum:               h.sum,
+		Min:               h.min,
+		Max:               h.max,
+		BucketCounts:      make([]string, 0, len(h.buckets)),
+		ExplicitBounds:    metricsLatencyBuckets,
+	}
+	for _, c := range h.buckets {
+		dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(c, 10))
+	}
+	return &otlpHistogramData{AggregationTemporality: otlpTemporalityCumulative, DataPoints: []otlpHistogramDataPoint{dp}}
+}
+
+func (s *OtlpSink) Flush() error {
+	return nil
+}
+
+func otlpAttr(k string, v string) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: v}}
+}
+
+// int64 is encoded as string in OTLP json encoding.
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,209 @@
+package benchmarker
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// interval of Reporter.Snapshot if BenchmarkSpec.ProgressInterval is not specified.
+	DefaultSnapshotInterval = time.Second
+)
+
+// counters of live progress, maintained by recorder, guarded by the recorder's mu.
+type liveCounters struct {
+	window      *Histogram // latency of requests completed since the last snapshot
+	statusCount map[int]int
+}
+
+// snapshot of live progress.
+type liveSnapshot struct {
+	total       int64
+	fail        int64
+	window      *Histogram
+	statusCount map[int]int
+}
+
+// take snapshot and reset the rolling window.
+func (r *recorder) liveSnapshot() liveSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := liveSnapshot{
+		total:       r.successCount + r.failCount,
+		fail:        r.failCount,
+		window:      r.live.window,
+		statusCount: make(map[int]int, len(r.live.statusCount)),
+	}
+	for k, v := range r.live.statusCount {
+		s.statusCount[k] = v
+	}
+	r.live.window = NewHistogram()
+	return s
+}
+
+// interval of snapshots, 0 if snapshots are disabled.
+func snapshotInterval(spec BenchmarkSpec) time.Duration {
+	if spec.ProgressInterval > 0 {
+		return spec.ProgressInterval
+	}
+	if len(spec.Reporters) > 0 {
+		return DefaultSnapshotInterval
+	}
+	return 0
+}
+
+// takes snapshots periodically and passes them to the reporters until it's stopped.
+type snapshotter struct {
+	rec       *recorder
+	reporters []Reporter
+	interval  time.Duration
+	start     time.Time
+	duration  time.Duration // only available if it's duration based
+	expected  int64         // expected number of requests, only available if it's round based
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// start taking snapshots, nil is returned if snapshots are disabled.
+func startSnapshots(spec BenchmarkSpec, rec *recorder, durBased bool, reporters []Reporter) *snapshotter {
+	interval := snapshotInterval(spec)
+	if interval <= 0 {
+		return nil
+	}
+	p := &snapshotter{rec: rec, reporters: reporters, interval: interval, start: time.Now(), duration: spec.Duration,
+		stop: make(chan struct{}), done: make(chan struct{})}
+	journey := slices.ContainsFunc(spec.Scenarios, func(s Scenario) bool { return len(s.Steps) > 0 })
+	if !durBased && spec.WebSocket == nil && !journey {
+		p.expected = int64(spec.Round)
+		if spec.Rate <= 0 {
+			p.expected *= int64(spec.Concurrent)
+		}
+	}
+	go p.run()
+	return p
+}
+
+func (p *snapshotter) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	last := p.start
+	var lastTotal int64
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			s := p.snapshot(now, last, lastTotal)
+			for _, r := range p.reporters {
+				r.Snapshot(s)
+			}
+			last, lastTotal = now, s.Requests
+		}
+	}
+}
+
+func (p *snapshotter) snapshot(now time.Time, last time.Time, lastTotal int64) Snapshot {
+	ls := p.rec.liveSnapshot()
+	s := Snapshot{
+		Elapsed:     now.Sub(p.start),
+		Requests:    ls.total,
+		Expected:    p.expected,
+		Failed:      ls.fail,
+		Rps:         float64(ls.total-lastTotal) / now.Sub(last).Seconds(),
+		Window:      ls.window.Count(),
+		StatusCount: ls.statusCount,
+	}
+	if p.duration > 0 {
+		s.Remaining = max(p.duration-s.Elapsed, 0)
+	}
+	if s.Window > 0 {
+		s.P50, s.P99 = ls.window.ValueAtPercentile(50), ls.window.ValueAtPercentile(99)
+	}
+	return s
+}
+
+// stop taking snapshots and wait until the goroutine exits.
+func (p *snapshotter) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
+
+// Reporter that prints the snapshots as live progress, progress is printed in place if stdout is a terminal.
+type progressReporter struct {
+	BaseReporter
+	spec BenchmarkSpec
+	tty  bool
+}
+
+func (p *progressReporter) Start(run RunInfo) error {
+	p.spec = run.Spec
+	p.tty = isTerminal(os.Stdout)
+	return nil
+}
+
+func (p *progressReporter) Snapshot(s Snapshot) {
+	line := p.format(s)
+	if p.tty {
+		fmt.Print("\r\033[K" + line)
+	} else {
+		fmt.Println(line)
+	}
+}
+
+func (p *progressReporter) Finish(r Report) error {
+	if p.tty {
+		fmt.Println()
+	}
+	return nil
+}
+
+func (p *progressReporter) format(s Snapshot) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("[%v", s.Elapsed.Truncate(time.Second)))
+	if p.spec.Duration > 0 {
+		sb.WriteString(fmt.Sprintf(", remaining %v", s.Remaining.Truncate(time.Second)))
+	}
+	sb.WriteString("] ")
+	if s.Expected > 0 {
+		sb.WriteString(fmt.Sprintf("requests: %d/%d", s.Requests, s.Expected))
+	} else {
+		sb.WriteString(fmt.Sprintf("requests: %d", s.Requests))
+	}
+	sb.WriteString(fmt.Sprintf(", rps: %.0f", s.Rps))
+	if s.Window > 0 {
+		sb.WriteString(fmt.Sprintf(", p50: %v, p99: %v", s.P50, s.P99))
+	} else {
+		sb.WriteString(", p50: -, p99: -")
+	}
+	sb.WriteString(fmt.Sprintf(", error_rate: %.2f%%", s.ErrorRate()*100))
+
+	codes := make([]int, 0, len(s.StatusCount))
+	for k := range s.StatusCount {
+		codes = append(codes, k)
+	}
+	sort.Ints(codes)
+	sb.WriteString(", status: {")
+	for i, k := range codes {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(fmt.Sprintf("%d: %d", k, s.StatusCount[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// whether f is a terminal (character device), progress is printed in place if it is.
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,189 @@
+package benchmarker
+
+import (
+	"sync"
+)
+
+// recorder records Benchmark results as they are produced by workers.
+//
+// recorder always maintains the success rate. If streaming is enabled, it also maintains the histograms and counters
+// that are needed for Stats, so that Benchmark records are only retained when they are needed.
+type recorder struct {
+	mu           sync.Mutex
+	successCount int64
+	failCount    int64
+
+	streaming   bool
+	keepRecords bool
+	took        *Histogram
+	corrected   *Histogram // only available in Rate mode
+	phases      map[string]*Histogram
+	statusCount map[int]int
+	scenarios   map[string]*recorder // only available if BenchmarkSpec.Scenarios is specified, guarded by the parent's mu
+	steps       map[string]*recorder // only available in recorder of journey scenarios, guarded by the parent's mu
+	journey     *Histogram           // only available in recorder of journey scenarios
+	journeyOk   map[bool]int
+	live        *liveCounters   // only available if snapshots are enabled, see snapshotInterval
+	metrics     *liveMetrics    // only available if BenchmarkSpec.MetricsAddr is specified
+	sinks       []*sinkPipeline // only available if BenchmarkSpec.Sinks is specified
+	reporters   *sinkPipeline   // passes records to Reporter.Record, only available if BenchmarkSpec.Reporters is specified
+}
+
+func newRecorder(spec BenchmarkSpec) *recorder {
+	r := &recorder{
+		streaming:   spec.StreamStats,
+		keepRecords: !spec.StreamStats || !spec.DisablePlotGraphs || !spec.DisableOutputFile || spec.HtmlReport || spec.SaveRunFilename != "" || len(spec.LogStatFunc) > 0,
+	}
+	if snapshotInterval(spec) > 0 {
+		r.live = &liveCounters{window: NewHistogram(), statusCount: map[int]int{}}
+	}
+	if r.streaming {
+		r.initHistograms(spec.Rate > 0)
+		if len(spec.Scenarios) > 0 {
+			r.scenarios = make(map[string]*recorder, len(spec.Scenarios))
+			for _, s := range spec.Scenarios {
+				sub := &recorder{streaming: true}
+				sub.initHistograms(spec.Rate > 0)
+				if len(s.Steps) > 0 {
+					sub.journey = NewHistogram()
+					sub.journeyOk = map[bool]int{}
+					sub.steps = make(map[string]*recorder, len(s.Steps))
+					for _, st := range s.Steps {
+						ss := &recorder{streaming: true}
+						ss.initHistograms(spec.Rate > 0)
+						sub.steps[st.Name] = ss
+					}
+				}
+				r.scenarios[s.Name] = sub
+			}
+		}
+	}
+	return r
+}
+
+func (r *recorder) initHistograms(corrected bool) {
+	r.took = NewHistogram()
+	r.statusCount = map[int]int{}
+	r.phases = make(map[string]*Histogram, len(timingPhases))
+	for _, p := range timingPhases {
+		r.phases[p.Name] = NewHistogram()
+	}
+	if corrected {
+		r.corrected = NewHistogram()
+	}
+}
+
+// record the result and update b.successRate, returns true if b should be retained.
+func (r *recorder) record(b *Benchmark) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count(b)
+	b.successRate = float64(r.successCount) / float64(r.successCount+r.failCount)
+	r.metrics.observe(b)
+	for _, s := range r.sinks {
+		s.offer(b)
+	}
+	if r.reporters != nil {
+		r.reporters.offer(b)
+	}
+	if r.live != nil {
+		r.live.window.Record(b.Took)
+		r.live.statusCount[b.HttpStatus]++
+	}
+
+	if r.streaming {
+		r.observe(b)
+		if sub, ok := r.scenarios[b.Scenario]; ok {
+			sub.count(b)
+			sub.observe(b)
+			if ss, ok := sub.steps[b.Step]; ok {
+				ss.count(b)
+				ss.observe(b)
+			}
+			if sub.journey != nil && b.JourneyTook > 0 {
+				sub.journey.Record(b.JourneyTook)
+				sub.journeyOk[b.Success]++
+			}
+		}
+	}
+	return r.keepRecords
+}
+
+func (r *recorder) count(b *Benchmark) {
+	if b.Success {
+		r.successCount += 1
+	} else {
+		r.failCount += 1
+	}
+}
+
+func (r *recorder) observe(b *Benchmark) {
+	r.took.Record(b.Took)
+	if r.corrected != nil {
+		r.corrected.Record(b.CorrectedTook)
+	}
+	for _, p := range timingPhases {
+		if v := p.Value(b); v > 0 {
+			r.phases[p.Name].Record(v)
+		}
+	}
+	r.statusCount[b.HttpStatus]++
+}
+
+// build Stats from the recorded histograms, only available if streaming is enabled.
+func (r *recorder) stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.buildStats()
+}
+
+func (r *recorder) buildStats() Stats {
+	st := Stats{
+		TotalRequests: r.took.Count(),
+		StatusCount:   r.statusCount,
+		SuccessCount:  map[bool]int{},
+		Min:           r.took.Min(),
+		Max:           r.took.Max(),
+		Avg:           r.took.Mean(),
+		Med:           r.took.ValueAtPercentile(50),
+		Percentiles:   map[int]Percentile{},
+	}
+	if r.successCount > 0 {
+		st.SuccessCount[true] = int(r.successCount)
+	}
+	if r.failCount > 0 {
+		st.SuccessCount[false] = int(r.failCount)
+	}
+	if st.TotalRequests > 0 {
+		for _, pv := range percentileValues {
+			st.Percentiles[pv] = Percentile{
+				Record: Benchmark{Took: r.took.ValueAtPercentile(float64(pv))},
+				Index:  int(r.took.percentileRank(float64(pv))),
+			}
+		}
+	}
+	st.Phases = make(map[string]LatencyStats, len(r.phases))
+	for name, h := range r.phases {
+		st.Phases[name] = h.latencyStats()
+	}
+	if r.corrected != nil {
+		corrected := r.corrected.latencyStats()
+		st.Corrected = &corrected
+	}
+	if len(r.scenarios) > 0 {
+		st.Scenarios = make(map[string]Stats, len(r.scenarios))
+		for name, sub := range r.scenarios {
+			st.Scenarios[name] = sub.buildStats()
+		}
+	}
+	if r.journey != nil {
+		st.Journey = &JourneyStats{LatencyStats: r.journey.latencyStats(), SuccessCount: r.journeyOk}
+		st.Steps = make(map[string]Stats, len(r.steps))
+		for name, ss := range r.steps {
+			st.Steps[name] = ss.buildStats()
+		}
+	}
+	return st
+}
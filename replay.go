@@ -0,0 +1,237 @@
+package benchmarker
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/curtisnewbie/miso/util/expr"
+	"github.com/spf13/cast"
+)
+
+const (
+	// each request is sent once in file order, the benchmark stops when all requests are sent.
+	ReplayOrderSeq = "seq"
+
+	// requests are picked randomly.
+	ReplayOrderRandom = "random"
+
+	// requests are sent in file order, starting over when all requests are sent.
+	ReplayOrderRoundRobin = "roundrobin"
+)
+
+// Request in the replay file (one json object per line).
+//
+// Body is sent as is if it's a string, otherwise it's serialized as json. UrlExpr, HeaderExpr and BodyExpr are
+// optional expr templates (same as -header and -json), they override Url, Headers and Body respectively, e.g.,
+//
+//	{"method": "GET", "url": "http://localhost:8080/order", "headers": {"x-token": "abc"}}
+//	{"method": "POST", "url": "http://localhost:8080/order", "body": {"orderId": "123"}}
+//	{"method": "POST", "url": "http://localhost:8080/order", "body_expr": "{ \"orderId\": randId() }"}
+type ReplayRequest struct {
+	Method     string            `json:"method"`
+	Url        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	Body       any               `json:"body"`
+	UrlExpr    string            `json:"url_expr"`
+	HeaderExpr string            `json:"header_expr"`
+	BodyExpr   string            `json:"body_expr"`
+}
+
+type compiledReplayRequest struct {
+	ReplayRequest
+	body       []byte
+	urlExpr    *expr.Expr[map[string]any]
+	headerExpr *expr.Expr[map[string]any]
+	bodyExpr   *expr.Expr[map[string]any]
+}
+
+// Replayer builds requests from the ReplayRequests, it's safe for concurrent use.
+//
+// Replayer is also a Reporter that rewinds the cursor at the start of each run (e.g., each concurrency group), add it to
+// BenchmarkSpec.Reporters to replay requests from the beginning in each run. Warmup requests are built by BuildRequest
+// as well, set BenchmarkSpec.DisableWarmup to send each request exactly once in ReplayOrderSeq.
+type Replayer struct {
+	BaseReporter
+	requests []compiledReplayRequest
+	order    string
+	cursor   atomic.Int64
+	env      map[string]any
+}
+
+// Load requests from jsonl file, blank lines are skipped.
+func LoadReplayRequests(file string) ([]ReplayRequest, error) {
+	f, err := util.OpenRFile(file)
+	if err != nil {
+		return nil, errs.WrapErrf(err, "failed to open replay file '%v'", file)
+	}
+	defer f.Close()
+	return ReadReplayRequests(f)
+}
+
+// Read requests in jsonl format, blank lines are skipped.
+func ReadReplayRequests(r io.Reader) ([]ReplayRequest, error) {
+	var requests []ReplayRequest
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var rr ReplayRequest
+		if err := json.ParseJson([]byte(line), &rr); err != nil {
+			return nil, errs.WrapErrf(err, "invalid replay request at line %d", ln)
+		}
+		if rr.Url == "" && rr.UrlExpr == "" {
+			return nil, errs.NewErrf("invalid replay request at line %d, url is empty", ln)
+		}
+		requests = append(requests, rr)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errs.WrapErrf(err, "failed to read replay requests")
+	}
+	return requests, nil
+}
+
+// Create Replayer, order is one of ReplayOrderSeq (default), ReplayOrderRandom and ReplayOrderRoundRobin.
+func NewReplayer(requests []ReplayRequest, order string) (*Replayer, error) {
+	if order == "" {
+		order = ReplayOrderSeq
+	}
+	if !util.EqualAnyStr(order, ReplayOrderSeq, ReplayOrderRandom, ReplayOrderRoundRobin) {
+		return nil, errs.NewErrf("Invalid replay order '%v', must be one of seq, random and roundrobin", order)
+	}
+	if len(requests) < 1 {
+		return nil, errs.NewErrf("No replay requests")
+	}
+
+	r := &Replayer{order: order, env: builtinExprEnv(), requests: make([]compiledReplayRequest, 0, len(requests))}
+	for i, rr := range requests {
+		c, err := compileReplayRequest(rr, r.env)
+		if err != nil {
+			return nil, errs.WrapErrf(err, "invalid replay request %d", i+1)
+		}
+		r.requests = append(r.requests, c)
+	}
+	return r, nil
+}
+
+func compileReplayRequest(rr ReplayRequest, env map[string]any) (compiledReplayRequest, error) {
+	c := compiledReplayRequest{ReplayRequest: rr}
+	c.Method = strings.ToUpper(rr.Method)
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+	switch v := rr.Body.(type) {
+	case nil:
+	case string:
+		c.body = []byte(v)
+	default:
+		buf, err := json.WriteJson(v)
+		if err != nil {
+			return c, errs.WrapErrf(err, "failed to serialize body")
+		}
+		c.body = buf
+	}
+
+	var err error
+	if c.urlExpr, err = compileReplayExpr(rr.UrlExpr, env); err != nil {
+		return c, errs.WrapErrf(err, "invalid url_expr")
+	}
+	if c.headerExpr, err = compileReplayExpr(rr.HeaderExpr, env); err != nil {
+		return c, errs.WrapErrf(err, "invalid header_expr")
+	}
+	if c.bodyExpr, err = compileReplayExpr(rr.BodyExpr, env); err != nil {
+		return c, errs.WrapErrf(err, "invalid body_expr")
+	}
+	return c, nil
+}
+
+func compileReplayExpr(s string, env map[string]any) (*expr.Expr[map[string]any], error) {
+	if s == "" {
+		return nil, nil
+	}
+	return expr.CompileEnv(s, env)
+}
+
+// Number of requests.
+func (r *Replayer) Len() int {
+	return len(r.requests)
+}
+
+// Build next request, implements BuildRequestFunc.
+//
+// In ReplayOrderSeq, ErrNoMoreRequests is returned when all requests are sent.
+func (r *Replayer) BuildRequest() (*http.Request, error) {
+	var i int
+	switch r.order {
+	case ReplayOrderRandom:
+		i = rand.IntN(len(r.requests))
+	case ReplayOrderRoundRobin:
+		i = int((r.cursor.Add(1) - 1) % int64(len(r.requests)))
+	default:
+		n := r.cursor.Add(1) - 1
+		if n >= int64(len(r.requests)) {
+			return nil, ErrNoMoreRequests
+		}
+		i = int(n)
+	}
+	return r.requests[i].build(r.env)
+}
+
+// Rewind the cursor, implements Reporter.
+func (r *Replayer) Start(run RunInfo) error {
+	r.cursor.Store(0)
+	return nil
+}
+
+// build request, expr templates are evaluated with env.
+func (c *compiledReplayRequest) build(env map[string]any) (*http.Request, error) {
+	url := c.Url
+	if c.urlExpr != nil {
+		out, err := c.urlExpr.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		url = cast.ToString(out)
+	}
+
+	var body io.Reader
+	if c.bodyExpr != nil {
+		out, err := c.bodyExpr.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		js, err := json.WriteJson(out)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(js)
+	} else if c.body != nil {
+		body = bytes.NewReader(c.body)
+	}
+
+	req, err := http.NewRequest(c.Method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Headers {
+		req.Header.Add(k, v)
+	}
+	if c.headerExpr != nil {
+		hv, err := c.headerExpr.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		addHeaders(req, hv)
+	}
+	return req, nil
+}
@@ -0,0 +1,217 @@
+package benchmarker
+
+import (
+	"slices"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+)
+
+// Reporter receives the progress and results of a benchmark, e.g., to print them or write them to files.
+//
+// The console output, data file, html report, saved run and plots are all implemented as reporters, custom reporters
+// can be added via BenchmarkSpec.Reporters. BaseReporter can be embedded to implement only some of the hooks.
+//
+// For StartConcGroupBenchmark, the hooks are called for each concurrency group.
+type Reporter interface {
+	// called before the workers are started, the benchmark is aborted if an error is returned.
+	Start(run RunInfo) error
+
+	// called for each Benchmark after it's recorded, calls are serialized and made by a dedicated goroutine in batches,
+	// so a slow reporter never blocks the workers, but records are dropped if the reporters can't keep up (see BenchmarkSpec.Reporters).
+	// All the records are passed before Finish is called.
+	//
+	// b must not be modified or retained.
+	Record(b *Benchmark)
+
+	// called periodically (BenchmarkSpec.ProgressInterval or DefaultSnapshotInterval) with live progress of the benchmark.
+	Snapshot(s Snapshot)
+
+	// called after the benchmark with the final Stats, reporters are called in order, and the remaining reporters are skipped if an error is returned.
+	//
+	// Report.Benchmarks must not be modified.
+	Finish(r Report) error
+}
+
+// No-op Reporter, it can be embedded to implement only some of the hooks.
+type BaseReporter struct{}
+
+func (BaseReporter) Start(run RunInfo) error { return nil }
+func (BaseReporter) Record(b *Benchmark)     {}
+func (BaseReporter) Snapshot(s Snapshot)     {}
+func (BaseReporter) Finish(r Report) error   { return nil }
+
+// Info of the benchmark run.
+type RunInfo struct {
+	// spec of the benchmark, with defaults filled.
+	Spec BenchmarkSpec
+
+	// time when the benchmark started.
+	StartTime time.Time
+}
+
+// Live progress of the benchmark.
+type Snapshot struct {
+	Elapsed   time.Duration
+	Remaining time.Duration // only available if BenchmarkSpec.Duration is specified
+	Requests  int64         // requests completed
+	Expected  int64         // expected number of requests, only available if it's round based
+	Failed    int64         // requests failed
+	Rps       float64       // throughput since the last snapshot
+
+	// number of requests completed since the last snapshot, P50 and P99 are their latency percentiles.
+	Window   int
+	P50, P99 time.Duration
+
+	StatusCount map[int]int
+}
+
+func (s Snapshot) ErrorRate() float64 {
+	if s.Requests < 1 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Requests)
+}
+
+// Final report of the benchmark.
+type Report struct {
+	RunInfo
+	Stats Stats
+
+	// records sorted by request order, nil if they are not retained, see BenchmarkSpec.StreamStats.
+	Benchmarks []Benchmark
+}
+
+// Sink that passes the records to Reporter.Record of BenchmarkSpec.Reporters, so that the reporters never block the workers.
+//
+// None of the built-in reporters need the records as they are recorded, they are not fed by the pipeline.
+type reporterSink struct {
+	reporters []Reporter
+}
+
+func (s reporterSink) Name() string { return "reporters" }
+
+func (s reporterSink) Write(batch []Benchmark) error {
+	for i := range batch {
+		for _, rp := range s.reporters {
+			rp.Record(&batch[i])
+		}
+	}
+	return nil
+}
+
+func (s reporterSink) Flush() error { return nil }
+
+// start pipeline that passes the records to BenchmarkSpec.Reporters, nil is returned if there is no custom reporter.
+func startReporterPipeline(spec BenchmarkSpec) *sinkPipeline {
+	if len(spec.Reporters) < 1 {
+		return nil
+	}
+	return startSinkPipeline(spec, reporterSink{reporters: spec.Reporters})
+}
+
+// pass the buffered records to the reporters and wait until it's done.
+func closeReporterPipeline(p *sinkPipeline) {
+	if p == nil {
+		return
+	}
+	if st := p.close(); st.Dropped > 0 {
+		util.Printlnf("Reporters can't keep up, %d records are not passed to Reporter.Record", st.Dropped)
+	}
+}
+
+// built-in reporters followed by BenchmarkSpec.Reporters.
+func buildReporters(spec BenchmarkSpec) []Reporter {
+	var reporters []Reporter
+	if spec.ProgressInterval > 0 {
+		reporters = append(reporters, &progressReporter{})
+	}
+	reporters = append(reporters, consoleReporter{})
+	if !spec.DisableOutputFile {
+		reporters = append(reporters, dataFileReporter{})
+	}
+	if spec.HtmlReport {
+		reporters = append(reporters, htmlReporter{})
+	}
+	if spec.SaveRunFilename != "" {
+		reporters = append(reporters, savedRunReporter{})
+	}
+	if !spec.DisablePlotGraphs {
+		reporters = append(reporters, plotReporter{})
+	}
+	return append(reporters, spec.Reporters...)
+}
+
+// Reporter that prints Stats to stdout.
+type consoleReporter struct {
+	BaseReporter
+}
+
+func (consoleReporter) Finish(r Report) error {
+	print(formatStats(r.Spec, r.Stats))
+	return nil
+}
+
+// Reporter that writes Stats and records to BenchmarkSpec.DataOutputFilename in BenchmarkSpec.OutputFormat.
+type dataFileReporter struct {
+	BaseReporter
+}
+
+func (dataFileReporter) Finish(r Report) error {
+	if r.Spec.OutputFormat != OutputFormatText {
+		return writeExport(r.Spec, r.Stats, r.Benchmarks)
+	}
+	return writeTextDataFile(r.Spec, r.Stats, r.Benchmarks)
+}
+
+// Reporter that generates the html report.
+type htmlReporter struct {
+	BaseReporter
+}
+
+func (htmlReporter) Finish(r Report) error {
+	return writeHtmlReport(r.Spec, r.Stats, r.Benchmarks)
+}
+
+// Reporter that saves the run to BenchmarkSpec.SaveRunFilename.
+type savedRunReporter struct {
+	BaseReporter
+}
+
+func (savedRunReporter) Finish(r Report) error {
+	return SaveRun(r.Spec.SaveRunFilename, r.Spec, r.Stats, r.Benchmarks)
+}
+
+// Reporter that plots the graphs in png.
+type plotReporter struct {
+	BaseReporter
+}
+
+func (plotReporter) Finish(r Report) error {
+	util.Printlnf("\n--------- Plots ---------------\n")
+
+	var (
+		spec              = r.Spec
+		stats             = r.Stats
+		sortedByTimestamp = r.Benchmarks
+		sortedByTook      = SortTook(slices.Clone(r.Benchmarks))
+	)
+
+	futures := util.NewAwaitFutures[any](nil)
+	futures.SubmitAsync(func() (any, error) {
+		return nil, plotLatencyGraph(spec, sortedByTimestamp, stats)
+	})
+	futures.SubmitAsync(func() (any, error) {
+		return nil, plotSuccessRateGraph(spec, sortedByTimestamp, stats)
+	})
+	futures.SubmitAsync(func() (any, error) {
+		return nil, plotPercentileGraph(spec, sortedByTook, stats)
+	})
+	futures.SubmitAsync(func() (any, error) {
+		return nil, plotDistributionGraphs(spec, sortedByTook, stats)
+	})
+	futures.SubmitAsync(func() (any, error) {
+		return nil, plotTimeGraphs(spec, sortedByTimestamp, stats)
+	})
+	return futures.AwaitAnyErr()
+}
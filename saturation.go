@@ -0,0 +1,208 @@
+package benchmarker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	DefaultSaturationMaxSteps         = 20
+	DefaultSaturationPlateauThreshold = 0.05
+)
+
+// Spec of saturation search.
+//
+// The load (concurrency or arrival rate) is increased step by step, until throughput plateaus or any SLO is breached.
+// BenchmarkSpec.Thresholds are also treated as SLOs, breaching them stops the search instead of failing it.
+type SaturationSpec struct {
+	// search by arrival rate (req/sec) instead of concurrency.
+	ByRate bool
+
+	// initial load, by default 1.
+	Start int
+
+	// load increased in each step, by default it's the same as Start.
+	Step int
+
+	// max load, by default Start + 19 * Step (i.e., 20 steps).
+	Max int
+
+	// min relative throughput gain compared to previous step, by default 0.05 (5%).
+	//
+	// If ByRate is true, throughput plateaus when the achieved throughput is lower than the offered rate by this ratio.
+	PlateauThreshold float64
+
+	// optional, latency SLO, P99 must not exceed MaxP99 (corrected P99 is used if ByRate is true).
+	MaxP99 time.Duration
+
+	// optional, error rate SLO (0-1), e.g., 0.01.
+	MaxErrorRate float64
+}
+
+type SaturationStep struct {
+	Load       int
+	Stats      Stats
+	Benchmarks []Benchmark
+
+	// whether the load is sustainable, i.e., throughput is still rising and SLOs are not breached.
+	Sustainable bool
+
+	// why the load is not sustainable.
+	Reason string
+}
+
+type SaturationResult struct {
+	Steps []SaturationStep
+
+	// max sustainable load, 0 if the initial load is not sustainable.
+	MaxSustainableLoad int
+
+	// throughput at MaxSustainableLoad.
+	MaxSustainableThroughput float64
+
+	StopReason string
+}
+
+// Search for the max sustainable load by increasing concurrency (or arrival rate) step by step.
+//
+// Each step is a complete benchmark using the given spec (e.g., Duration or Round),
+// output files of each step are prefixed with 'search_conc{load}_' or 'search_rate{load}_'.
+//
+// Stages are not supported. If ByRate is true, Round is the total number of requests of each step, so either Duration
+// or a Round that lasts at least 1s at the max rate is required.
+func FindSaturation(spec BenchmarkSpec, ss SaturationSpec) (SaturationResult, error) {
+	return FindSaturationContext(context.Background(), spec, ss)
+}
+
+// Same as FindSaturation, but the search is stopped once ctx is done, ErrInterrupted is returned along with the completed steps.
+func FindSaturationContext(ctx context.Context, spec BenchmarkSpec, ss SaturationSpec) (SaturationResult, error) {
+	if ss.Start < 1 {
+		ss.Start = 1
+	}
+	if ss.Step < 1 {
+		ss.Step = ss.Start
+	}
+	if ss.Max < ss.Start {
+		ss.Max = ss.Start + (DefaultSaturationMaxSteps-1)*ss.Step
+	}
+	if ss.PlateauThreshold <= 0 {
+		ss.PlateauThreshold = DefaultSaturationPlateauThreshold
+	}
+	if len(spec.Stages) > 0 {
+		return SaturationResult{}, errs.NewErrf("Stages are not supported in saturation search, the load is controlled by the search")
+	}
+	if ss.ByRate && spec.Duration <= 0 && spec.Round < ss.Max {
+		// in Rate mode, Round is the total number of requests, a few requests per step are not enough to tell whether throughput plateaus
+		return SaturationResult{}, errs.NewErrf("Duration or Round (at least %d, i.e., 1s at the max rate) is required when searching by rate, got Round %d",
+			ss.Max, spec.Round)
+	}
+
+	var res SaturationResult
+	var prevThroughput float64
+	for load := ss.Start; load <= ss.Max; load += ss.Step {
+		cp := withFilePrefix(spec, fmt.Sprintf("search_%s%d_", ss.loadName(), load))
+		if ss.ByRate {
+			cp.Rate = float64(load)
+		} else {
+			cp.Concurrent = load
+		}
+
+		util.Printlnf("\n--------- Saturation Step %d: %s %d ---\n", len(res.Steps)+1, ss.loadName(), load)
+		b, st, err := StartBenchmarkContext(ctx, cp)
+		step := SaturationStep{Load: load, Stats: st, Benchmarks: b}
+		if errors.Is(err, ErrInterrupted) {
+			// the partial step is not used to judge sustainability
+			step.Reason = "interrupted"
+			res.Steps = append(res.Steps, step)
+			res.StopReason = fmt.Sprintf("interrupted at %s %d", ss.loadName(), load)
+			printSaturation(ss, res)
+			return res, err
+		}
+		if err != nil && !errors.Is(err, ErrThresholdBreached) {
+			res.Steps = append(res.Steps, step)
+			return res, err
+		}
+
+		step.Reason = ss.checkStep(load, st, prevThroughput)
+		step.Sustainable = step.Reason == ""
+		res.Steps = append(res.Steps, step)
+		if !step.Sustainable {
+			res.StopReason = fmt.Sprintf("%s at %s %d", step.Reason, ss.loadName(), load)
+			break
+		}
+		res.MaxSustainableLoad = load
+		res.MaxSustainableThroughput = st.Throughput
+		prevThroughput = st.Throughput
+	}
+	if res.StopReason == "" {
+		res.StopReason = fmt.Sprintf("max %s %d reached", ss.loadName(), ss.Max)
+	}
+
+	printSaturation(ss, res)
+	return res, nil
+}
+
+func (ss SaturationSpec) loadName() string {
+	if ss.ByRate {
+		return "rate"
+	}
+	return "conc"
+}
+
+// check whether the step is sustainable, returns the reason if it's not.
+func (ss SaturationSpec) checkStep(load int, st Stats, prevThroughput float64) string {
+	if failed := failedThresholds(st.Thresholds); len(failed) > 0 {
+		return fmt.Sprintf("threshold breached (%s)", strings.Join(failed, ", "))
+	}
+	if ss.MaxErrorRate > 0 && st.ErrorRate() > ss.MaxErrorRate {
+		return fmt.Sprintf("error rate %.4f exceeded SLO %v", st.ErrorRate(), ss.MaxErrorRate)
+	}
+	if p99 := saturationP99(st); ss.MaxP99 > 0 && p99 > ss.MaxP99 {
+		return fmt.Sprintf("P99 %v exceeded SLO %v", p99, ss.MaxP99)
+	}
+	if ss.ByRate {
+		if st.Throughput < float64(load)*(1-ss.PlateauThreshold) {
+			return fmt.Sprintf("throughput %.0f req/sec can't keep up with the arrival rate", st.Throughput)
+		}
+	} else if prevThroughput > 0 && st.Throughput < prevThroughput*(1+ss.PlateauThreshold) {
+		return fmt.Sprintf("throughput plateaued (%.0f -> %.0f req/sec)", prevThroughput, st.Throughput)
+	}
+	return ""
+}
+
+func saturationP99(st Stats) time.Duration {
+	if st.Corrected != nil {
+		return st.Corrected.Percentiles[99]
+	}
+	return st.Percentiles[99].Record.Took
+}
+
+func printSaturation(ss SaturationSpec, res SaturationResult) {
+	sb := strings.Builder{}
+	sb.WriteString("\n--------- Saturation ----------\n\n")
+
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "step\t%s\tthroughput\tmedian\tP99\terror_rate\tsustainable\n", ss.loadName())
+	for i, s := range res.Steps {
+		fmt.Fprintf(tw, "%d\t%d\t%.0f req/sec\t%v\t%v\t%.4f\t%v\n", i+1, s.Load, s.Stats.Throughput, s.Stats.Med,
+			saturationP99(s.Stats), s.Stats.ErrorRate(), s.Sustainable)
+	}
+	tw.Flush()
+
+	sb.WriteString("\n")
+	if res.MaxSustainableLoad > 0 {
+		sb.WriteString(fmt.Sprintf("max sustainable %s: %d (%.0f req/sec)\n", ss.loadName(), res.MaxSustainableLoad, res.MaxSustainableThroughput))
+	} else {
+		sb.WriteString(fmt.Sprintf("max sustainable %s: none\n", ss.loadName()))
+	}
+	sb.WriteString(fmt.Sprintf("stop reason: %s\n", res.StopReason))
+	sb.WriteString("\n-------------------------------\n")
+	print(sb.String())
+}
@@ -0,0 +1,117 @@
+package benchmarker
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+// Scenario of a weighted traffic mix, e.g., 70% reads and 30% writes.
+type Scenario struct {
+	// required, unique name of the scenario, requests are tagged with it (Benchmark.Scenario).
+	Name string
+
+	// required, relative weight of the scenario, e.g., 7 and 3 for 70% reads and 30% writes.
+	Weight int
+
+	// required unless Steps is specified, func to build request of the scenario.
+	BuildReqFunc BuildRequestFunc
+
+	// optional, by default BenchmarkSpec.ParseResFunc is used.
+	ParseResFunc ParseResponseFunc
+
+	// optional, multi-step user journey, steps are sent in order by the same virtual user (worker),
+	// each step may extract values from the response for later steps.
+	//
+	// A journey is a single round (or a single scheduled arrival in Rate mode), each step is recorded as a request,
+	// stats are broken down by step and the whole journey latency is reported as well.
+	Steps []JourneyStep
+}
+
+// draws scenarios by weight, it's safe for concurrent use.
+type scenarioPicker struct {
+	scenarios []Scenario
+	cumWeight []int
+}
+
+func newScenarioPicker(scenarios []Scenario) *scenarioPicker {
+	p := &scenarioPicker{scenarios: scenarios, cumWeight: make([]int, 0, len(scenarios))}
+	total := 0
+	for _, s := range scenarios {
+		total += s.Weight
+		p.cumWeight = append(p.cumWeight, total)
+	}
+	return p
+}
+
+func (p *scenarioPicker) pick() *Scenario {
+	w := rand.IntN(p.cumWeight[len(p.cumWeight)-1])
+	i := sort.SearchInts(p.cumWeight, w+1)
+	return &p.scenarios[i]
+}
+
+// validate scenarios and fill default values, a copy of the scenarios is returned.
+func prepareScenarios(scenarios []Scenario, parseRes ParseResponseFunc) ([]Scenario, error) {
+	scenarios = slices.Clone(scenarios)
+	names := make(map[string]struct{}, len(scenarios))
+	for i := range scenarios {
+		s := &scenarios[i]
+		if s.Name == "" {
+			return nil, errs.NewErrf("Scenario name is required")
+		}
+		if _, ok := names[s.Name]; ok {
+			return nil, errs.NewErrf("Duplicate scenario name '%v'", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if s.Weight < 1 {
+			return nil, errs.NewErrf("Weight of scenario '%v' must be greater than 0", s.Name)
+		}
+		if s.BuildReqFunc == nil && len(s.Steps) < 1 {
+			return nil, errs.NewErrf("BuildReqFunc of scenario '%v' is required", s.Name)
+		}
+		if s.BuildReqFunc != nil && len(s.Steps) > 0 {
+			return nil, errs.NewErrf("BuildReqFunc and Steps of scenario '%v' are mutually exclusive", s.Name)
+		}
+		if s.ParseResFunc == nil {
+			s.ParseResFunc = parseRes
+		}
+		if len(s.Steps) > 0 {
+			steps, err := prepareSteps(s)
+			if err != nil {
+				return nil, err
+			}
+			s.Steps = steps
+		}
+	}
+	return scenarios, nil
+}
+
+// calculate stats of each scenario, bench is not modified.
+func computeScenarioStats(spec BenchmarkSpec, bench []Benchmark) map[string]Stats {
+	groups := make(map[string][]Benchmark, len(spec.Scenarios))
+	for _, s := range spec.Scenarios {
+		groups[s.Name] = []Benchmark{}
+	}
+	for _, b := range bench {
+		if g, ok := groups[b.Scenario]; ok {
+			groups[b.Scenario] = append(g, b)
+		}
+	}
+
+	cp := spec
+	cp.Scenarios = nil
+	st := make(map[string]Stats, len(groups))
+	for i := range spec.Scenarios {
+		sc := &spec.Scenarios[i]
+		g := groups[sc.Name]
+		ss := computeStats(cp, g)
+		if len(sc.Steps) > 0 {
+			ss.Steps = computeStepStats(cp, sc, g)
+			ss.Journey = computeJourneyStats(g)
+		}
+		st[sc.Name] = ss
+	}
+	return st
+}
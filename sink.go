@@ -0,0 +1,172 @@
+package benchmarker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+)
+
+const (
+	DefaultSinkBatchSize     = 1000
+	DefaultSinkFlushInterval = time.Second
+	DefaultSinkBufferSize    = 100_000
+)
+
+// Sink receives the Benchmark records as they are recorded, e.g., to stream them to a time-series backend.
+//
+// Records are buffered and written in batches by a dedicated goroutine, so that a slow sink never blocks the workers,
+// records are dropped if the buffer is full. See BenchmarkSpec.Sinks.
+type Sink interface {
+	// name of the sink, e.g., 'influxdb'.
+	Name() string
+
+	// write a batch of records, it's never called concurrently.
+	Write(batch []Benchmark) error
+
+	// flush the written records if they are buffered, it's called at the end of each benchmark after the last batch is written.
+	Flush() error
+}
+
+// stats of a Sink.
+type SinkStats struct {
+	Name    string
+	Written int // records written successfully
+	Failed  int // records failed to be written
+	Dropped int // records dropped because the buffer is full
+}
+
+// buffers records and writes them to the sink in batches.
+type sinkPipeline struct {
+	sink      Sink
+	batchSize int
+	interval  time.Duration
+	buf       chan Benchmark
+	done      chan struct{}
+
+	mu        sync.Mutex
+	stats     SinkStats
+	lastError error
+}
+
+// start pipelines of BenchmarkSpec.Sinks.
+func startSinks(spec BenchmarkSpec) []*sinkPipeline {
+	pipelines := make([]*sinkPipeline, 0, len(spec.Sinks))
+	for _, s := range spec.Sinks {
+		pipelines = append(pipelines, startSinkPipeline(spec, s))
+	}
+	return pipelines
+}
+
+// start pipeline of the sink, configured by BenchmarkSpec.SinkBatchSize, SinkFlushInterval and SinkBufferSize.
+func startSinkPipeline(spec BenchmarkSpec, s Sink) *sinkPipeline {
+	batchSize := spec.SinkBatchSize
+	if batchSize < 1 {
+		batchSize = DefaultSinkBatchSize
+	}
+	interval := spec.SinkFlushInterval
+	if interval <= 0 {
+		interval = DefaultSinkFlushInterval
+	}
+	bufSize := spec.SinkBufferSize
+	if bufSize < 1 {
+		bufSize = DefaultSinkBufferSize
+	}
+	p := &sinkPipeline{
+		sink:      s,
+		batchSize: batchSize,
+		interval:  interval,
+		buf:       make(chan Benchmark, bufSize),
+		done:      make(chan struct{}),
+		stats:     SinkStats{Name: s.Name()},
+	}
+	go p.run()
+	return p
+}
+
+// offer the record without blocking, the record is dropped if the buffer is full.
+func (p *sinkPipeline) offer(b *Benchmark) {
+	select {
+	case p.buf <- *b:
+	default:
+		p.mu.Lock()
+		p.stats.Dropped++
+		p.mu.Unlock()
+	}
+}
+
+func (p *sinkPipeline) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	batch := make([]Benchmark, 0, p.batchSize)
+	for {
+		select {
+		case b, ok := <-p.buf:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, b)
+			if len(batch) >= p.batchSize {
+				p.flush(batch)
+				batch = make([]Benchmark, 0, p.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]Benchmark, 0, p.batchSize)
+			}
+		}
+	}
+}
+
+func (p *sinkPipeline) flush(batch []Benchmark) {
+	if len(batch) < 1 {
+		return
+	}
+	err := p.sink.Write(batch)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.stats.Failed += len(batch)
+		p.lastError = err
+		return
+	}
+	p.stats.Written += len(batch)
+}
+
+// write the buffered records, flush the sink and wait until it's done.
+func (p *sinkPipeline) close() SinkStats {
+	close(p.buf)
+	<-p.done
+	if err := p.sink.Flush(); err != nil {
+		util.Printlnf("Failed to flush sink %v, %v", p.sink.Name(), err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastError != nil {
+		util.Printlnf("Failed to write %d records to sink %v, last error: %v", p.stats.Failed, p.sink.Name(), p.lastError)
+	}
+	return p.stats
+}
+
+// close all the pipelines, returns stats of each sink.
+func closeSinks(pipelines []*sinkPipeline) []SinkStats {
+	if len(pipelines) < 1 {
+		return nil
+	}
+	stats := make([]SinkStats, len(pipelines))
+	var wg sync.WaitGroup
+	for i, p := range pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i] = p.close()
+		}()
+	}
+	wg.Wait()
+	return stats
+}
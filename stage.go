@@ -0,0 +1,113 @@
+package benchmarker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/spf13/cast"
+)
+
+const (
+	// how often an idle worker (or the dispatcher) checks the current stage target.
+	stagePollInterval = 10 * time.Millisecond
+)
+
+// Stage of a load profile.
+//
+// Target is the number of active workers, or the arrival rate (req/sec) if BenchmarkSpec.StageByRate is true.
+// Target is ramped linearly from the previous stage's Target (0 for the first stage) to this stage's Target over Duration.
+type Stage struct {
+	Target   int
+	Duration time.Duration
+}
+
+func (s Stage) String() string {
+	return fmt.Sprintf("%v:%d", s.Duration, s.Target)
+}
+
+// Parse stages, e.g., "10s:50,1m:50,10s:0" means ramping up to 50 in 10s, holding 50 for 1m and ramping down to 0 in 10s.
+func ParseStages(s string) ([]Stage, error) {
+	stages := []Stage{}
+	for _, tok := range strings.Split(s, ",") {
+		if util.IsBlankStr(tok) {
+			continue
+		}
+		ds, ts, ok := strings.Cut(strings.TrimSpace(tok), ":")
+		if !ok {
+			return nil, errs.NewErrf("Invalid stage '%v', should be in format 'duration:target', e.g., '10s:50'", tok)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ds))
+		if err != nil {
+			return nil, errs.WrapErrf(err, "Invalid stage duration '%v'", ds)
+		}
+		t, err := cast.ToIntE(strings.TrimSpace(ts))
+		if err != nil {
+			return nil, errs.WrapErrf(err, "Invalid stage target '%v'", ts)
+		}
+		if d <= 0 || t < 0 {
+			return nil, errs.NewErrf("Invalid stage '%v', duration must be positive and target must not be negative", tok)
+		}
+		stages = append(stages, Stage{Target: t, Duration: d})
+	}
+	return stages, nil
+}
+
+func stagesDuration(stages []Stage) time.Duration {
+	var d time.Duration
+	for _, s := range stages {
+		d += s.Duration
+	}
+	return d
+}
+
+func stagesMaxTarget(stages []Stage) int {
+	m := 0
+	for _, s := range stages {
+		m = max(m, s.Target)
+	}
+	return m
+}
+
+// calculate the ramped target at the given elapsed time.
+func stageTarget(stages []Stage, elapsed time.Duration) float64 {
+	prev := 0.0
+	for _, s := range stages {
+		if elapsed < s.Duration {
+			return prev + (float64(s.Target)-prev)*float64(elapsed)/float64(s.Duration)
+		}
+		elapsed -= s.Duration
+		prev = float64(s.Target)
+	}
+	return prev
+}
+
+// dispatch requests following the staged arrival rate until all stages are completed, dispatch returns false or ctx is done.
+func dispatchStagedRate(ctx context.Context, stages []Stage, startTime time.Time, dispatch func(next time.Time) bool) {
+	var (
+		total   = stagesDuration(stages)
+		elapsed time.Duration
+		credit  float64 // accumulated number of requests to be sent
+	)
+	for elapsed <= total {
+		if credit >= 1 {
+			next := startTime.Add(elapsed)
+			if !sleepCtx(ctx, time.Until(next)) || !dispatch(next) {
+				return
+			}
+			credit -= 1
+			continue
+		}
+
+		r := stageTarget(stages, elapsed)
+		step := stagePollInterval
+		if r > 0 {
+			step = min(step, time.Duration((1-credit)/r*float64(time.Second))+1)
+		}
+		credit += r * step.Seconds()
+		elapsed += step
+	}
+}
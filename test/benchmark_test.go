@@ -1,13 +1,57 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/curtisnewbie/benchmarker"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+// spec with the plots of each run written to dir.
+func plotFiles(dir string) benchmarker.BenchmarkSpec {
+	return benchmarker.BenchmarkSpec{
+		PlotSortedByRequestOrderFilename: filepath.Join(dir, "request_order.png"),
+		PlotSortedByLatencyFilename:      filepath.Join(dir, "latency.png"),
+		PlotSuccessRateFilename:          filepath.Join(dir, "success_rate.png"),
+		PlotThroughputFilename:           filepath.Join(dir, "throughput.png"),
+		PlotLatencyOverTimeFilename:      filepath.Join(dir, "latency_over_time.png"),
+		PlotErrorRateFilename:            filepath.Join(dir, "error_rate.png"),
+		PlotHistogramFilename:            filepath.Join(dir, "latency_histogram.png"),
+		PlotCdfFilename:                  filepath.Join(dir, "latency_cdf.png"),
+	}
+}
+
+// filenames of the plots of each run.
+func plotFilenames(spec benchmarker.BenchmarkSpec) []string {
+	return []string{spec.PlotSortedByRequestOrderFilename, spec.PlotSortedByLatencyFilename, spec.PlotSuccessRateFilename,
+		spec.PlotThroughputFilename, spec.PlotLatencyOverTimeFilename, spec.PlotErrorRateFilename, spec.PlotHistogramFilename, spec.PlotCdfFilename}
+}
+
 func TestStartBenchmark(t *testing.T) {
 	_, _, _ = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
 		Concurrent: 3,
@@ -45,3 +89,2009 @@ func TestStartBenchmarkCli(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestStartBenchmarkRate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Rate:              100,
+		Round:             50,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 50 {
+		t.Fatalf("expected 50 requests, got %v", stats.TotalRequests)
+	}
+	if stats.TotalTime < 450*time.Millisecond {
+		t.Fatalf("requests are not sent at the expected rate, total_time: %v", stats.TotalTime)
+	}
+}
+
+func TestStartBenchmarkRateCorrected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	// one worker can't keep up with 100 req/sec, requests are queued
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Rate:              100,
+		MaxWorkers:        1,
+		Round:             20,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Corrected == nil {
+		t.Fatal("corrected latency stats is missing")
+	}
+	if stats.Corrected.Max <= stats.Max {
+		t.Fatalf("corrected latency should include queueing delay, max: %v, corrected max: %v", stats.Max, stats.Corrected.Max)
+	}
+}
+
+func TestStartBenchmarkRateWorkersOnDemand(t *testing.T) {
+	var warmups, inFlight, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/warmup" {
+			warmups.Add(1)
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	// 500 req/sec with 5ms latency needs only a few workers, they are started on demand instead of 500 workers upfront
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Rate:              500,
+		Round:             500,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		WarmupReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL+"/warmup", nil)
+		},
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 500 || stats.SuccessCount[true] != 500 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if w := warmups.Load(); w != 1 {
+		t.Fatalf("only the initial worker should send warmup request, got %v", w)
+	}
+	if p := peak.Load(); p > 50 {
+		t.Fatalf("too many concurrent requests, peak: %v", p)
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	stages, err := benchmarker.ParseStages("10s:50,1m:50,10s:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []benchmarker.Stage{
+		{Target: 50, Duration: 10 * time.Second},
+		{Target: 50, Duration: time.Minute},
+		{Target: 0, Duration: 10 * time.Second},
+	}
+	if len(stages) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, stages)
+	}
+	for i := range expected {
+		if stages[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, stages)
+		}
+	}
+
+	if _, err := benchmarker.ParseStages("10s"); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestStartBenchmarkStages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	// ramp up to 100 req/sec in 1s, ~50 requests in total
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Stages:            []benchmarker.Stage{{Target: 100, Duration: time.Second}},
+		StageByRate:       true,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests < 45 || stats.TotalRequests > 55 {
+		t.Fatalf("expected ~50 requests, got %v", stats.TotalRequests)
+	}
+
+	_, stats, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Stages:            []benchmarker.Stage{{Target: 4, Duration: 200 * time.Millisecond}, {Target: 0, Duration: 200 * time.Millisecond}},
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests < 1 || stats.TotalTime < 400*time.Millisecond {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestFindSaturation(t *testing.T) {
+	// the server handles one request at a time, throughput can't be improved by adding more workers
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	res, err := benchmarker.FindSaturation(benchmarker.BenchmarkSpec{
+		Duration:          300 * time.Millisecond,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	}, benchmarker.SaturationSpec{Start: 1, Step: 1, Max: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MaxSustainableLoad != 1 {
+		t.Fatalf("expected max sustainable concurrency 1, got %v, %v", res.MaxSustainableLoad, res.StopReason)
+	}
+	if len(res.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %v", len(res.Steps))
+	}
+
+	// stage profile conflicts with the search
+	spec := benchmarker.BenchmarkSpec{
+		Stages:            []benchmarker.Stage{{Target: 2, Duration: 100 * time.Millisecond}},
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	}
+	if _, err := benchmarker.FindSaturation(spec, benchmarker.SaturationSpec{Start: 1, Max: 2}); err == nil {
+		t.Fatal("stages should be rejected")
+	}
+
+	// a few requests per rate step are not enough
+	spec.Stages = nil
+	spec.Round = 2
+	if _, err := benchmarker.FindSaturation(spec, benchmarker.SaturationSpec{ByRate: true, Start: 10, Max: 50}); err == nil {
+		t.Fatal("rate search without Duration should be rejected")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := benchmarker.NewHistogram()
+	for i := 1; i <= 100000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	if h.Count() != 100000 {
+		t.Fatalf("count: %v", h.Count())
+	}
+	if h.Min() != time.Microsecond || h.Max() != 100*time.Millisecond {
+		t.Fatalf("min: %v, max: %v", h.Min(), h.Max())
+	}
+	for _, p := range []float64{50, 75, 90, 95, 99} {
+		exact := time.Duration(p*1000) * time.Microsecond
+		v := h.ValueAtPercentile(p)
+		if diff := math.Abs(float64(v-exact)) / float64(exact); diff > 0.002 {
+			t.Fatalf("P%v: %v, expected: %v", p, v, exact)
+		}
+	}
+}
+
+func TestStartBenchmarkStreamStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        3,
+		Round:             100,
+		StreamStats:       true,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bench) > 0 {
+		t.Fatalf("records should not be retained, got %v", len(bench))
+	}
+	if stats.TotalRequests != 300 || stats.StatusCount[200] != 300 || stats.SuccessCount[true] != 300 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Min > stats.Med || stats.Med > stats.Percentiles[99].Record.Took || stats.Percentiles[99].Record.Took > stats.Max {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestStartBenchmarkTimingBreakdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	for _, stream := range []bool{false, true} {
+		_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:        2,
+			Round:             5,
+			StreamStats:       stream,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			BuildReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttfb := stats.Phases["ttfb"]; ttfb.Count != 10 || ttfb.Min < 10*time.Millisecond {
+			t.Fatalf("unexpected ttfb stats: %+v", ttfb)
+		}
+	}
+}
+
+func TestStartBenchmarkOutputFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, format := range []string{benchmarker.OutputFormatJson, benchmarker.OutputFormatNdjson, benchmarker.OutputFormatCsv} {
+		fname := filepath.Join(dir, "records."+format)
+		_, _, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:         2,
+			Round:              5,
+			DisablePlotGraphs:  true,
+			OutputFormat:       format,
+			DataOutputFilename: fname,
+			BuildReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+		switch format {
+		case benchmarker.OutputFormatJson:
+			var run benchmarker.ExportRun
+			if err := json.Unmarshal(buf, &run); err != nil {
+				t.Fatal(err)
+			}
+			if run.Stats.TotalRequests != 10 || len(run.Records) != 10 || run.Stats.StatusCount["200"] != 10 {
+				t.Fatalf("unexpected json output: %s", buf)
+			}
+		case benchmarker.OutputFormatNdjson:
+			if len(lines) != 11 || !strings.Contains(lines[0], `"type":"stats"`) || !strings.Contains(lines[1], `"type":"record"`) {
+				t.Fatalf("unexpected ndjson output: %s", buf)
+			}
+		case benchmarker.OutputFormatCsv:
+			if len(lines) != 11 || !strings.HasPrefix(lines[0], "timestamp_us,") {
+				t.Fatalf("unexpected csv output: %s", buf)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "records_stats.csv")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestStartBenchmarkHtmlReport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	fname := filepath.Join(t.TempDir(), "report.html")
+	_, _, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:         2,
+		Round:              5,
+		DisablePlotGraphs:  true,
+		DisableOutputFile:  true,
+		StreamStats:        true,
+		HtmlReport:         true,
+		HtmlReportFilename: fname,
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+		LogStatFunc: []benchmarker.LogExtraStatFunc{
+			func(b []benchmarker.Benchmark) string { return "records: <" + strconv.Itoa(len(b)) + ">" },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(buf)
+	for _, s := range []string{"Total Requests", "P99", `"id":"latency"`, `"id":"throughput"`, `"id":"success-rate"`, "records: &lt;10&gt;"} {
+		if !strings.Contains(html, s) {
+			t.Fatalf("missing %q in html report: %s", s, html)
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	th, err := benchmarker.ParseThreshold("p99 <= 200ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.Metric != "p99" || th.Op != "<=" || th.Value != float64(200*time.Millisecond) {
+		t.Fatalf("unexpected threshold: %+v", th)
+	}
+	th, err = benchmarker.ParseThreshold("error_rate<1%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.Metric != "error_rate" || th.Op != "<" || th.Value != 0.01 {
+		t.Fatalf("unexpected threshold: %+v", th)
+	}
+
+	for _, s := range []string{"p99", "p99 < abc", "p42 < 1s", "throughput =< 1", "unknown > 1", "< 1"} {
+		if _, err := benchmarker.ParseThreshold(s); err == nil {
+			t.Fatalf("%q should fail", s)
+		}
+	}
+}
+
+func TestStartBenchmarkThresholds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	spec := benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Round:             5,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		Thresholds:        []string{"p99 < 10s", "error_rate < 0.01", "total_requests == 10"},
+		BuildReqFunc: func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		},
+	}
+	_, stats, err := benchmarker.StartBenchmark(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Thresholds) != 3 {
+		t.Fatalf("unexpected threshold results: %+v", stats.Thresholds)
+	}
+
+	spec.Thresholds = []string{"p99 < 10s", "throughput > 1000000000"}
+	_, stats, err = benchmarker.StartBenchmark(spec)
+	if !errors.Is(err, benchmarker.ErrThresholdBreached) {
+		t.Fatalf("expected ErrThresholdBreached, got %v", err)
+	}
+	if !stats.Thresholds[0].Pass || stats.Thresholds[1].Pass {
+		t.Fatalf("unexpected threshold results: %+v", stats.Thresholds)
+	}
+
+	// corrected latency is only available in Rate mode, it's rejected before the run
+	spec.Thresholds = []string{"p99 < 10s", "corrected_p99 < 1s"}
+	bench, _, err := benchmarker.StartBenchmark(spec)
+	if err == nil || errors.Is(err, benchmarker.ErrThresholdBreached) || len(bench) > 0 {
+		t.Fatalf("expected setup error, got %v, records: %d", err, len(bench))
+	}
+
+	spec.Rate, spec.Round = 50, 10
+	if _, stats, err = benchmarker.StartBenchmark(spec); err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Thresholds[1].Available {
+		t.Fatalf("unexpected threshold results: %+v", stats.Thresholds)
+	}
+}
+
+func TestReplayRequests(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.Method+" "+r.URL.Path+" "+r.Header.Get("x-id")+" "+string(buf)]++
+	}))
+	defer srv.Close()
+
+	lines := []string{
+		`{"method": "GET", "url": "` + srv.URL + `/a", "headers": {"x-id": "1"}}`,
+		``,
+		`{"method": "post", "url": "` + srv.URL + `/b", "body": {"id": 2}}`,
+		`{"method": "POST", "url": "` + srv.URL + `/c", "body": "raw"}`,
+		`{"url_expr": "'` + srv.URL + `/d/' + string(1 + 1)", "header_expr": "{ \"x-id\": \"4\" }"}`,
+	}
+	fname := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := os.WriteFile(fname, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := benchmarker.LoadReplayRequests(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 requests, got %v", len(requests))
+	}
+
+	// seq, the benchmark stops when all requests are sent
+	for _, spec := range []benchmarker.BenchmarkSpec{{Concurrent: 3, Round: 100}, {Rate: 50, Round: 100}} {
+		rp, err := benchmarker.NewReplayer(requests, benchmarker.ReplayOrderSeq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec.DisablePlotGraphs = true
+		spec.DisableOutputFile = true
+		spec.BuildReqFunc = rp.BuildRequest
+		spec.DisableWarmup = true
+		spec.Reporters = []benchmarker.Reporter{rp}
+		for run := 0; run < 2; run++ { // requests are replayed from the beginning in each run
+			mu.Lock()
+			received = map[string]int{}
+			mu.Unlock()
+			_, stats, err := benchmarker.StartBenchmark(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalRequests != 4 || stats.SuccessCount[true] != 4 {
+				t.Fatalf("unexpected stats: %+v", stats)
+			}
+			if stats.TotalTime > time.Second {
+				t.Fatalf("benchmark should stop when all requests are sent, total_time: %v", stats.TotalTime)
+			}
+			mu.Lock()
+			if len(received) != 4 {
+				t.Fatalf("unexpected requests received: %v", received)
+			}
+			for _, k := range []string{"GET /a 1 ", "POST /b  {\"id\":2}", "POST /c  raw", "GET /d/2 4 "} {
+				if received[k] != 1 {
+					t.Fatalf("expected %q to be received once, got %v", k, received)
+				}
+			}
+			mu.Unlock()
+		}
+	}
+
+	// roundrobin
+	rp, err := benchmarker.NewReplayer(requests, benchmarker.ReplayOrderRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Round:             10,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc:      rp.BuildRequest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 20 {
+		t.Fatalf("expected 20 requests, got %v", stats.TotalRequests)
+	}
+
+	if _, err := benchmarker.NewReplayer(requests, "unknown"); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestStartBenchmarkScenarios(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, stream := range []bool{false, true} {
+		spec := plotFiles(dir)
+		spec.Concurrent = 2
+		spec.Round = 100
+		spec.StreamStats = stream
+		spec.DisableOutputFile = true
+		spec.HtmlReport = true
+		spec.HtmlReportFilename = filepath.Join(dir, "report.html")
+		spec.Scenarios = []benchmarker.Scenario{
+			{Name: "read", Weight: 7, BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL+"/read", nil) }},
+			{Name: "write", Weight: 3, BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodPost, srv.URL+"/write", nil) }},
+		}
+		bench, stats, err := benchmarker.StartBenchmark(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, write := stats.Scenarios["read"], stats.Scenarios["write"]
+		if stats.TotalRequests != 200 || read.TotalRequests+write.TotalRequests != 200 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		if read.TotalRequests < 100 || read.TotalRequests > 180 {
+			t.Fatalf("requests are not drawn by weight, read: %v, write: %v", read.TotalRequests, write.TotalRequests)
+		}
+		if read.ErrorRate() != 0 || write.ErrorRate() != 1 || write.StatusCount[500] != write.TotalRequests {
+			t.Fatalf("unexpected scenario stats, read: %+v, write: %+v", read, write)
+		}
+		for _, b := range bench {
+			if (b.Scenario == "write") == b.Success {
+				t.Fatalf("unexpected record: %+v", b)
+			}
+		}
+	}
+
+	_, _, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Scenarios: []benchmarker.Scenario{{Name: "read", Weight: 0, BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL, nil) }}},
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestStartBenchmarkJourney(t *testing.T) {
+	var seq atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+			w.Write([]byte(`{"data": {"token": "tk-` + strconv.FormatInt(seq.Add(1), 10) + `"}}`))
+		case r.URL.Path == "/order" && strings.HasPrefix(r.Header.Get("x-token"), "tk-"):
+			w.Header().Set("x-order-id", "ord-"+strings.TrimPrefix(r.Header.Get("x-token"), "tk-"))
+		case strings.HasPrefix(r.URL.Path, "/order/ord-"):
+			w.Write([]byte(`<status>paid</status>`))
+		case r.URL.Path == "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	order, err := benchmarker.NewJourney(benchmarker.JourneyFile{
+		Name: "order",
+		Steps: []benchmarker.JourneyFileStep{
+			{Name: "login", ReplayRequest: benchmarker.ReplayRequest{Method: "POST", Url: srv.URL + "/login"},
+				Extract: []benchmarker.Extractor{{Var: "token", Path: "$.data.token"}}},
+			{Name: "create", ReplayRequest: benchmarker.ReplayRequest{Method: "POST", Url: srv.URL + "/order", HeaderExpr: `{"x-token": vars.token}`},
+				Extract: []benchmarker.Extractor{{Var: "orderId", From: benchmarker.ExtractFromHeader, Path: "X-Order-Id"}}},
+			{Name: "fetch", ReplayRequest: benchmarker.ReplayRequest{UrlExpr: `"` + srv.URL + `/order/" + vars.orderId`},
+				Extract: []benchmarker.Extractor{{Var: "status", From: benchmarker.ExtractFromRegex, Path: "<status>(\\w+)</status>"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := benchmarker.Scenario{
+		Name:   "failing",
+		Weight: 1,
+		Steps: []benchmarker.JourneyStep{
+			{Name: "fail", BuildReqFunc: func(vars map[string]any) (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL+"/fail", nil)
+			}},
+			{Name: "skipped", BuildReqFunc: func(vars map[string]any) (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL, nil) }},
+		},
+	}
+
+	for _, stream := range []bool{false, true} {
+		bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:        2,
+			Round:             20,
+			StreamStats:       stream,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			Scenarios:         []benchmarker.Scenario{order, failing},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ord, fl := stats.Scenarios["order"], stats.Scenarios["failing"]
+		if ord.Journey == nil || fl.Journey == nil || ord.Journey.Count+fl.Journey.Count != 40 {
+			t.Fatalf("unexpected journey stats, order: %+v, failing: %+v", ord.Journey, fl.Journey)
+		}
+		if ord.Journey.SuccessCount[false] != 0 || ord.TotalRequests != ord.Journey.Count*3 || ord.Journey.Min < ord.Min {
+			t.Fatalf("unexpected order journey stats: %+v, %+v", ord.Journey, ord)
+		}
+		for _, step := range []string{"login", "create", "fetch"} {
+			if st := ord.Steps[step]; st.TotalRequests != ord.Journey.Count || st.ErrorRate() != 0 {
+				t.Fatalf("unexpected stats of step %v: %+v", step, st)
+			}
+		}
+		if fl.Journey.SuccessCount[false] != fl.Journey.Count || fl.Steps["fail"].TotalRequests != fl.Journey.Count || fl.Steps["skipped"].TotalRequests != 0 {
+			t.Fatalf("unexpected failing journey stats: %+v, %+v", fl.Journey, fl.Steps)
+		}
+		if stats.TotalRequests != ord.TotalRequests+fl.TotalRequests {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		for _, b := range bench {
+			if (b.Step == "fetch" || b.Step == "fail") != (b.JourneyTook > 0) {
+				t.Fatalf("unexpected record: %+v", b)
+			}
+		}
+	}
+
+	_, err = benchmarker.NewJourney(benchmarker.JourneyFile{Name: "invalid", Steps: []benchmarker.JourneyFileStep{
+		{Name: "fetch", ReplayRequest: benchmarker.ReplayRequest{UrlExpr: `"/order/" + orderId`}},
+	}})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestStartBenchmarkJourneyVars(t *testing.T) {
+	var logins atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" && logins.Add(1) == 2 {
+			w.Write([]byte(`{}`)) // login of the second journey fails, token is not extracted
+			return
+		}
+		w.Write([]byte(`{"token": "tk"}`))
+	}))
+	defer srv.Close()
+
+	var (
+		mu    sync.Mutex
+		stale []map[string]any
+	)
+	scenario := benchmarker.Scenario{
+		Name:   "vars",
+		Weight: 1,
+		Steps: []benchmarker.JourneyStep{
+			{Name: "login", Extract: []benchmarker.Extractor{{Var: "token", Path: "$.token"}},
+				BuildReqFunc: func(vars map[string]any) (*http.Request, error) {
+					if len(vars) > 0 {
+						mu.Lock()
+						stale = append(stale, maps.Clone(vars))
+						mu.Unlock()
+					}
+					return http.NewRequest(http.MethodPost, srv.URL+"/login", nil)
+				}},
+			{Name: "fetch", BuildReqFunc: func(vars map[string]any) (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL+"/fetch?token="+vars["token"].(string), nil)
+			}},
+		},
+	}
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        1,
+		Round:             3,
+		DisableWarmup:     true,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		Scenarios:         []benchmarker.Scenario{scenario},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) > 0 {
+		t.Fatalf("vars of previous journeys leaked: %+v", stale)
+	}
+	sc := stats.Scenarios["vars"]
+	if sc.Steps["login"].TotalRequests != 3 || sc.Steps["login"].SuccessCount[true] != 2 || sc.Steps["fetch"].TotalRequests != 2 {
+		t.Fatalf("unexpected step stats: %+v", sc.Steps)
+	}
+}
+
+func TestStartBenchmarkAssert(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Api-Version", "2")
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(`{"error": false, "data": [1, 2]}`))
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"error": false, "data": [1]}`))
+		case "/text":
+			w.Write([]byte(`pong`))
+		default:
+			w.Write([]byte(`{"error": true}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		assert  string
+		success bool
+	}{
+		{"/ok", `status == 200 && body.error == false && len(body.data) > 0`, true},
+		{"/bad", `status == 200 && body.error == false && len(body.data) > 0`, false},
+		{"/ok", `status == 200 && headers["x-api-version"] == "2"`, true},
+		{"/ok", `status == 201`, false},
+		{"/text", `body == "pong"`, true},
+	}
+	for _, tt := range tests {
+		bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Round:             3,
+			Assert:            tt.assert,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			BuildReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.SuccessCount[tt.success] != 3 {
+			t.Fatalf("%v '%v', unexpected success count: %v", tt.path, tt.assert, stats.SuccessCount)
+		}
+		for _, b := range bench {
+			if failed, ok := b.Extra[benchmarker.ExtraAssertionFailed]; tt.success == ok || (ok && failed != tt.assert) {
+				t.Fatalf("%v '%v', unexpected extra: %v", tt.path, tt.assert, b.Extra)
+			}
+		}
+	}
+
+	// assertion only adds failures, non-200 responses are still unsuccessful by default
+	created := func() (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL+"/created", nil) }
+	bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Round:             3,
+		Assert:            `status == 201`,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc:      created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SuccessCount[false] != 3 || bench[0].Extra[benchmarker.ExtraAssertionFailed] != nil {
+		t.Fatalf("unexpected result: %v, %+v", stats.SuccessCount, bench[0])
+	}
+	_, stats, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Round:             3,
+		Assert:            `status == 201 && headers["x-api-version"] == "2"`,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc:      created,
+		ParseResFunc: func(buf []byte, statusCode int) benchmarker.Result {
+			return benchmarker.Result{Success: statusCode >= 200 && statusCode < 300}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SuccessCount[true] != 3 {
+		t.Fatalf("unexpected success count: %v", stats.SuccessCount)
+	}
+
+	_, _, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Assert:     `status == 200`,
+		InvokeFunc: func(ctx context.Context) (benchmarker.Result, error) { return benchmarker.Result{Success: true}, nil },
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+
+	_, _, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Assert:       `status ==`,
+		BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL, nil) },
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+type grpcTestServer struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (s *grpcTestServer) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("x-token")) < 1 {
+		return nil, status.Error(codes.Unauthenticated, "missing x-token")
+	}
+	return &testpb.SimpleResponse{Payload: &testpb.Payload{Body: make([]byte, req.ResponseSize)}}, nil
+}
+
+// blocks until the call is cancelled.
+func (s *grpcTestServer) EmptyCall(ctx context.Context, req *testpb.Empty) (*testpb.Empty, error) {
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func (s *grpcTestServer) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream grpc.ServerStreamingServer[testpb.StreamingOutputCallResponse]) error {
+	for _, p := range req.ResponseParameters {
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: make([]byte, p.Size)}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStartBenchmarkGrpc(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	testpb.RegisterTestServiceServer(srv, &grpcTestServer{})
+	reflection.Register(srv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	protoset := filepath.Join(t.TempDir(), "test.protoset")
+	buf, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(testpb.File_grpc_testing_test_proto)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(protoset, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		spec     benchmarker.GrpcSpec
+		status   int
+		messages int
+	}{
+		{"unary (reflection)", benchmarker.GrpcSpec{
+			Method:            "grpc.testing.TestService/UnaryCall",
+			BuildMsgFunc:      func() ([]byte, error) { return []byte(`{"responseSize": 3}`), nil },
+			BuildMetadataFunc: func() (map[string]string, error) { return map[string]string{"x-token": "abc"}, nil },
+			Connections:       2,
+		}, int(codes.OK), 0},
+		{"unary without metadata", benchmarker.GrpcSpec{
+			Method: "/grpc.testing.TestService/UnaryCall",
+		}, int(codes.Unauthenticated), 0},
+		{"server-streaming (descriptor set)", benchmarker.GrpcSpec{
+			Method:            "grpc.testing.TestService/StreamingOutputCall",
+			DescriptorSetFile: protoset,
+			BuildMsgFunc:      func() ([]byte, error) { return []byte(`{"responseParameters": [{"size": 1}, {"size": 2}]}`), nil },
+		}, int(codes.OK), 2},
+	}
+	for _, tt := range tests {
+		tt.spec.Target = lis.Addr().String()
+		g, err := benchmarker.NewGrpcInvoker(tt.spec)
+		if err != nil {
+			t.Fatalf("%v, %v", tt.name, err)
+		}
+		bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:        2,
+			Round:             10,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			InvokeFunc:        g.Invoke,
+		})
+		g.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalRequests != 20 || stats.StatusCount[tt.status] != 20 || stats.SuccessCount[tt.status == int(codes.OK)] != 20 {
+			t.Fatalf("%v, unexpected stats: %+v", tt.name, stats)
+		}
+		for _, b := range bench {
+			if tt.messages > 0 && b.Extra[benchmarker.ExtraGrpcMessages] != tt.messages {
+				t.Fatalf("%v, unexpected record: %+v", tt.name, b)
+			}
+		}
+	}
+
+	for _, method := range []string{"grpc.testing.TestService/NotFound", "grpc.testing.TestService/StreamingInputCall", "grpc.testing.NotFound/UnaryCall"} {
+		if _, err := benchmarker.NewGrpcInvoker(benchmarker.GrpcSpec{Target: lis.Addr().String(), Method: method}); err == nil {
+			t.Fatalf("%v, should fail", method)
+		}
+	}
+}
+
+func TestStartBenchmarkWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var m map[string]any
+			_ = json.Unmarshal(msg, &m)
+			switch r.URL.Path {
+			case "/drop":
+				if m["drop"] == true {
+					continue
+				}
+			case "/corr":
+				// unrelated message pushed before the reply
+				conn.WriteMessage(mt, []byte(`{"id": "push"}`))
+			}
+			conn.WriteMessage(mt, msg)
+		}
+	}))
+	defer srv.Close()
+	wsUrl := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	var seq atomic.Int64
+	buildMsg := func() ([]byte, error) {
+		n := seq.Add(1)
+		return json.Marshal(map[string]any{"id": n, "drop": n%2 == 0})
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		corr         string
+		rate         float64
+		sent         int
+		received     int
+		dropped      int
+		unmatched    int
+		replyTimeout time.Duration
+	}{
+		{name: "echo", path: "/echo", sent: 30, received: 30},
+		{name: "echo rate", path: "/echo", corr: "id", rate: 200, sent: 30, received: 30},
+		{name: "correlation", path: "/corr", corr: "id", sent: 30, received: 30, unmatched: 30},
+		{name: "dropped", path: "/drop", corr: "id", rate: 200, sent: 30, received: 15, dropped: 15, replyTimeout: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		round := 10
+		if tt.rate > 0 {
+			round = 30
+		}
+		bench, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:        3,
+			Round:             round,
+			Rate:              tt.rate,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			WebSocket: &benchmarker.WebSocketSpec{
+				Url:              wsUrl + tt.path,
+				BuildMsgFunc:     buildMsg,
+				CorrelationField: tt.corr,
+				ReplyTimeout:     tt.replyTimeout,
+			},
+		})
+		if err != nil {
+			t.Fatalf("%v, %v", tt.name, err)
+		}
+		ws := stats.WebSocket
+		if ws == nil || ws.Connections != 3 || ws.Connect.Count != 3 {
+			t.Fatalf("%v, unexpected websocket stats: %+v", tt.name, ws)
+		}
+		if ws.Sent != tt.sent || ws.Received != tt.received || ws.Dropped != tt.dropped || ws.Unmatched != tt.unmatched || ws.Failed != 0 {
+			t.Fatalf("%v, unexpected websocket stats: %+v", tt.name, ws)
+		}
+		if stats.TotalRequests != tt.sent || stats.SuccessCount[true] != tt.received || stats.SuccessCount[false] != tt.dropped {
+			t.Fatalf("%v, unexpected stats: %+v", tt.name, stats)
+		}
+		if tt.rate > 0 && stats.Corrected == nil {
+			t.Fatalf("%v, corrected latency missing", tt.name)
+		}
+		for _, b := range bench {
+			if b.Success && b.Took <= 0 {
+				t.Fatalf("%v, unexpected record: %+v", tt.name, b)
+			}
+		}
+	}
+
+	_, stats, err := benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		WebSocket:         &benchmarker.WebSocketSpec{Url: "ws://127.0.0.1:1/none", BuildMsgFunc: buildMsg},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.WebSocket.FailedConnections != 2 || stats.TotalRequests != 0 {
+		t.Fatalf("unexpected websocket stats: %+v", stats.WebSocket)
+	}
+
+	// the handshake is never answered, it's bounded by HandshakeTimeout rather than ReplyTimeout
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	start := time.Now()
+	_, stats, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        1,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		WebSocket: &benchmarker.WebSocketSpec{Url: "ws://" + ln.Addr().String() + "/hang", BuildMsgFunc: buildMsg,
+			ReplyTimeout: time.Minute, HandshakeTimeout: 100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.WebSocket.FailedConnections != 1 || time.Since(start) > 5*time.Second {
+		t.Fatalf("unexpected websocket stats: %+v, took: %v", stats.WebSocket, time.Since(start))
+	}
+
+	_, _, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		WebSocket:    &benchmarker.WebSocketSpec{Url: wsUrl, BuildMsgFunc: buildMsg},
+		BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodGet, srv.URL, nil) },
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+
+	// replies can't be matched by order in Rate mode
+	_, _, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Rate:      100,
+		WebSocket: &benchmarker.WebSocketSpec{Url: wsUrl, BuildMsgFunc: buildMsg},
+	})
+	if err == nil {
+		t.Fatal("should fail without CorrelationField in Rate mode")
+	}
+}
+
+func TestStartFuncBenchmark(t *testing.T) {
+	var calls atomic.Int64
+	f := func(ctx context.Context) benchmarker.Result {
+		n := calls.Add(1)
+		time.Sleep(time.Millisecond)
+		if n%4 == 0 {
+			return benchmarker.Result{HttpStatus: 1, Extra: map[string]any{"ERROR": "busy"}}
+		}
+		return benchmarker.Result{Success: true}
+	}
+
+	bench, stats, err := benchmarker.StartFuncBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Round:             10,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+	}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 22 { // including warmup
+		t.Fatalf("unexpected calls: %v", calls.Load())
+	}
+	if len(bench) != 20 || stats.TotalRequests != 20 || stats.StatusCount[0]+stats.StatusCount[1] != 20 || stats.SuccessCount[true] != stats.StatusCount[0] {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Min < time.Millisecond {
+		t.Fatalf("unexpected latency: %v", stats.Min)
+	}
+
+	_, stats, err = benchmarker.StartFuncBenchmark(benchmarker.BenchmarkSpec{
+		Rate:              200,
+		Round:             20,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+	}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 20 || stats.Corrected == nil {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	_, _, err = benchmarker.StartFuncBenchmark(benchmarker.BenchmarkSpec{
+		BuildReqFunc: func() (*http.Request, error) { return http.NewRequest(http.MethodGet, "http://localhost", nil) },
+	}, f)
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestStartBenchmarkContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := 20 * time.Millisecond
+		if r.URL.Path == "/slow" {
+			d = time.Minute
+		}
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		path string
+		rate float64
+	}{
+		{"closed", "/", 0},
+		{"rate", "/", 100},
+		{"in-flight", "/slow", 0},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		start := time.Now()
+		bench, stats, err := benchmarker.StartBenchmarkContext(ctx, benchmarker.BenchmarkSpec{
+			Concurrent:         2,
+			Rate:               tt.rate,
+			Duration:           time.Minute,
+			DisablePlotGraphs:  true,
+			OutputFormat:       benchmarker.OutputFormatJson,
+			DataOutputFilename: filepath.Join(dir, "records.json"),
+			BuildReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			},
+			WarmupReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			},
+		})
+		cancel()
+		if !errors.Is(err, benchmarker.ErrInterrupted) {
+			t.Fatalf("%v, unexpected error: %v", tt.name, err)
+		}
+		if took := time.Since(start); took > 5*time.Second {
+			t.Fatalf("%v, not stopped in time: %v", tt.name, took)
+		}
+		if !stats.Interrupted || len(bench) != stats.TotalRequests || stats.SuccessCount[false] > 0 {
+			t.Fatalf("%v, unexpected stats: %+v", tt.name, stats)
+		}
+		if tt.path == "/slow" && stats.TotalRequests != 0 {
+			t.Fatalf("%v, in-flight requests should be discarded: %+v", tt.name, stats)
+		} else if tt.path != "/slow" && stats.TotalRequests < 1 {
+			t.Fatalf("%v, partial results missing: %+v", tt.name, stats)
+		}
+
+		buf, err := os.ReadFile(filepath.Join(dir, "records.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var run benchmarker.ExportRun
+		if err := json.Unmarshal(buf, &run); err != nil {
+			t.Fatal(err)
+		}
+		if !run.Stats.Interrupted || len(run.Records) != stats.TotalRequests {
+			t.Fatalf("%v, unexpected data file: %+v", tt.name, run.Stats)
+		}
+	}
+
+	var calls atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	_, stats, err := benchmarker.StartFuncBenchmarkContext(ctx, benchmarker.BenchmarkSpec{
+		Duration:          time.Minute,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+	}, func(ctx context.Context) benchmarker.Result {
+		if calls.Add(1) == 10 {
+			cancel()
+		}
+		<-time.After(time.Millisecond)
+		return benchmarker.Result{Success: ctx.Err() == nil}
+	})
+	if !errors.Is(err, benchmarker.ErrInterrupted) || !stats.Interrupted || stats.TotalRequests != 8 || stats.SuccessCount[true] != 8 {
+		t.Fatalf("unexpected stats: %+v, %v", stats, err)
+	}
+
+	// in-flight non-http calls are cancelled as well
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	testpb.RegisterTestServiceServer(gs, &grpcTestServer{})
+	reflection.Register(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	g, err := benchmarker.NewGrpcInvoker(benchmarker.GrpcSpec{
+		Target:  lis.Addr().String(),
+		Method:  "grpc.testing.TestService/EmptyCall",
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	blocking := func(ctx context.Context) benchmarker.Result {
+		<-ctx.Done()
+		return benchmarker.Result{}
+	}
+
+	for name, run := range map[string]func(ctx context.Context, spec benchmarker.BenchmarkSpec) (benchmarker.Stats, error){
+		"grpc": func(ctx context.Context, spec benchmarker.BenchmarkSpec) (benchmarker.Stats, error) {
+			spec.InvokeFunc = g.Invoke
+			_, stats, err := benchmarker.StartBenchmarkContext(ctx, spec)
+			return stats, err
+		},
+		"func": func(ctx context.Context, spec benchmarker.BenchmarkSpec) (benchmarker.Stats, error) {
+			_, stats, err := benchmarker.StartFuncBenchmarkContext(ctx, spec, blocking)
+			return stats, err
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		start := time.Now()
+		stats, err := run(ctx, benchmarker.BenchmarkSpec{
+			Concurrent:        2,
+			Duration:          time.Minute,
+			DisableWarmup:     true,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+		})
+		cancel()
+		if !errors.Is(err, benchmarker.ErrInterrupted) {
+			t.Fatalf("%v, unexpected error: %v", name, err)
+		}
+		if took := time.Since(start); took > 2*time.Second {
+			t.Fatalf("%v, in-flight calls are not cancelled: %v", name, took)
+		}
+		if !stats.Interrupted || stats.TotalRequests != 0 {
+			t.Fatalf("%v, in-flight calls should be discarded: %+v", name, stats)
+		}
+	}
+}
+
+func TestStartBenchmarkProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	// capture stdout, progress is printed line by line since it's not a terminal
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	var out strings.Builder
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		close(copied)
+	}()
+
+	var n atomic.Int64
+	_, _, err = benchmarker.StartBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Duration:          time.Second,
+		ProgressInterval:  200 * time.Millisecond,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		BuildReqFunc: func() (*http.Request, error) {
+			url := srv.URL
+			if n.Add(1)%10 == 0 {
+				url += "?fail=1"
+			}
+			return http.NewRequest(http.MethodGet, url, nil)
+		},
+	})
+	os.Stdout = stdout
+	w.Close()
+	<-copied
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, l := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(l, "[") && strings.Contains(l, "rps:") {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) < 3 {
+		t.Fatalf("unexpected progress: %q", out.String())
+	}
+	last := lines[len(lines)-1]
+	for _, s := range []string{"remaining", "requests:", "p50:", "p99:", "error_rate:", "200:", "500:"} {
+		if !strings.Contains(last, s) {
+			t.Fatalf("'%v' missing in progress: %v", s, last)
+		}
+	}
+}
+
+func TestStartBenchmarkTimePlots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var n atomic.Int64
+	for _, rate := range []float64{0, 200} {
+		spec := plotFiles(dir)
+		spec.Concurrent = 2
+		spec.Rate = rate
+		spec.Duration = time.Second
+		spec.PlotBucketWidth = 100 * time.Millisecond
+		spec.DisableOutputFile = true
+		spec.BuildReqFunc = func() (*http.Request, error) {
+			url := srv.URL
+			if n.Add(1)%5 == 0 {
+				url += "?fail=1"
+			}
+			return http.NewRequest(http.MethodGet, url, nil)
+		}
+		if _, _, err := benchmarker.StartBenchmark(spec); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{spec.PlotThroughputFilename, spec.PlotLatencyOverTimeFilename, spec.PlotErrorRateFilename} {
+			if st, err := os.Stat(f); err != nil || st.Size() == 0 {
+				t.Fatalf("plot %v is not generated, %v", f, err)
+			}
+			os.Remove(f)
+		}
+	}
+}
+
+func TestStartBenchmarkDistributionPlots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var n atomic.Int64
+	newSpec := func(splitBy string) benchmarker.BenchmarkSpec {
+		spec := plotFiles(dir)
+		spec.Concurrent = 2
+		spec.Round = 100
+		spec.PlotSplitBy = splitBy
+		spec.DisableOutputFile = true
+		spec.BuildReqFunc = func() (*http.Request, error) {
+			url := srv.URL
+			if n.Add(1)%5 == 0 {
+				url += "?fail=1"
+			}
+			return http.NewRequest(http.MethodGet, url, nil)
+		}
+		return spec
+	}
+
+	for _, splitBy := range []string{"", benchmarker.PlotSplitByStatus, benchmarker.PlotSplitBySuccess} {
+		spec := newSpec(splitBy)
+		if _, _, err := benchmarker.StartBenchmark(spec); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{spec.PlotHistogramFilename, spec.PlotCdfFilename} {
+			if st, err := os.Stat(f); err != nil || st.Size() == 0 {
+				t.Fatalf("plot %v is not generated (split by %q), %v", f, splitBy, err)
+			}
+			os.Remove(f)
+		}
+	}
+
+	if _, _, err := benchmarker.StartBenchmark(newSpec("method")); err == nil {
+		t.Fatal("invalid PlotSplitBy should be rejected")
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	var delay atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(delay.Load()))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	run := func(d time.Duration, name string) string {
+		delay.Store(int64(d))
+		spec := benchmarker.BenchmarkSpec{
+			Concurrent:        2,
+			Round:             50,
+			StreamStats:       true,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			SaveRunFilename:   filepath.Join(dir, name),
+			BuildReqFunc: func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			},
+		}
+		if _, _, err := benchmarker.StartBenchmark(spec); err != nil {
+			t.Fatal(err)
+		}
+		return spec.SaveRunFilename
+	}
+	baseline := run(time.Millisecond, "baseline.json")
+	current := run(10*time.Millisecond, "current.json")
+
+	saved, err := benchmarker.LoadRun(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.LatencyNs) != 100 || saved.Stats.TotalRequests != 100 {
+		t.Fatalf("unexpected saved run, samples: %d, stats: %+v", len(saved.LatencyNs), saved.Stats)
+	}
+
+	cmp, err := benchmarker.CompareRunFiles(baseline, current, benchmarker.CompareSpec{})
+	if !errors.Is(err, benchmarker.ErrRegression) {
+		t.Fatalf("expected ErrRegression, got %v", err)
+	}
+	if !cmp.Significant || cmp.MannWhitney.P >= 0.05 || cmp.MannWhitney.Effect < 0.9 {
+		t.Fatalf("unexpected mann whitney result: %+v", cmp.MannWhitney)
+	}
+
+	// faster than the baseline
+	cmp, err = benchmarker.CompareRunFiles(current, baseline, benchmarker.CompareSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp.Regressed || cmp.Significant {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+
+	// degraded beyond the tolerance, but not significant
+	base := benchmarker.SavedRun{LatencyNs: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+	base.Stats.Latency.AvgNs = 100
+	cur := benchmarker.SavedRun{LatencyNs: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 11}}
+	cur.Stats.Latency.AvgNs = 110
+	cmp = benchmarker.CompareRuns(base, cur, benchmarker.CompareSpec{Tolerance: 0.05})
+	if cmp.Regressed || cmp.Significant || !cmp.Metrics[1].Degraded {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+}
+
+func TestStartConcGroupBenchmark(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+	}))
+	defer srv.Close()
+
+	if g := benchmarker.ParseConcGroups(" 1, 0,,4,-2,8"); len(g) != 3 || g[0] != 1 || g[1] != 4 || g[2] != 8 {
+		t.Fatalf("unexpected groups: %v", g)
+	}
+
+	dir := t.TempDir()
+	spec := plotFiles("") // relative, they are prefixed with 'conc{N}_'
+	spec.Round = 10
+	spec.DisableOutputFile = true
+	spec.PlotConcGroupThroughputFilename = filepath.Join(dir, "concgroup_throughput.png")
+	spec.PlotConcGroupLatencyFilename = filepath.Join(dir, "concgroup_latency.png")
+	spec.BuildReqFunc = func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	}
+	groups, err := benchmarker.StartConcGroupBenchmark(spec, []int{1, 2, 4})
+	t.Cleanup(func() {
+		for _, c := range []int{1, 2, 4} {
+			for _, f := range plotFilenames(spec) {
+				os.Remove("conc" + strconv.Itoa(c) + "_" + f)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+	for i, c := range []int{1, 2, 4} {
+		if groups[i].Concurrency != c || groups[i].Stats.TotalRequests != 10*c {
+			t.Fatalf("unexpected group %d: concurrency: %d, requests: %d", i, groups[i].Concurrency, groups[i].Stats.TotalRequests)
+		}
+	}
+	for _, f := range []string{spec.PlotConcGroupThroughputFilename, spec.PlotConcGroupLatencyFilename} {
+		if st, err := os.Stat(f); err != nil || st.Size() == 0 {
+			t.Fatalf("plot %v is not generated, %v", f, err)
+		}
+	}
+
+	if _, err := benchmarker.StartConcGroupBenchmark(spec, nil); err == nil {
+		t.Fatal("empty concurrency groups should be rejected")
+	}
+}
+
+func TestStartBenchmarkMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var (
+		n       atomic.Int64
+		scraped string
+	)
+	spec := benchmarker.BenchmarkSpec{
+		Concurrent:        1,
+		Round:             50,
+		Rate:              500,
+		MaxWorkers:        1,
+		MetricsAddr:       addr,
+		MetricsLinger:     -1,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+	}
+	_, _, err = benchmarker.StartFuncBenchmark(spec, func(ctx context.Context) benchmarker.Result {
+		i := n.Add(1)
+		if i == 40 {
+			res, err := http.Get("http://" + addr + "/metrics")
+			if err != nil {
+				t.Error(err)
+				return benchmarker.Result{}
+			}
+			defer res.Body.Close()
+			buf, _ := io.ReadAll(res.Body)
+			scraped = string(buf)
+		}
+		if i%3 == 0 {
+			return benchmarker.Result{HttpStatus: 500}
+		}
+		return benchmarker.Result{HttpStatus: 200, Success: true}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`benchmarker_requests_total{status="200",success="true"}`,
+		`benchmarker_requests_total{status="500",success="false"}`,
+		"benchmarker_requests_in_flight 1", // the request that scrapes the metrics
+		"benchmarker_request_duration_seconds_bucket",
+		"benchmarker_request_corrected_duration_seconds_bucket",
+	} {
+		if !strings.Contains(scraped, s) {
+			t.Fatalf("metric '%v' is missing", s)
+		}
+	}
+
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("metrics endpoint should be closed after the benchmark")
+	}
+
+	// final values are scraped during the linger, which is cut short once ctx is done
+	finished := &finishReporter{done: make(chan struct{})}
+	spec.MetricsLinger = time.Minute
+	spec.Reporters = []benchmarker.Reporter{finished}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-finished.done
+		defer cancel()
+		res, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer res.Body.Close()
+		buf, _ := io.ReadAll(res.Body)
+		scraped = string(buf)
+	}()
+	start := time.Now()
+	_, _, err = benchmarker.StartFuncBenchmarkContext(ctx, spec, func(ctx context.Context) benchmarker.Result {
+		return benchmarker.Result{HttpStatus: 200, Success: true}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(scraped, `benchmarker_requests_total{status="200",success="true"} 50`) || time.Since(start) > 30*time.Second {
+		t.Fatalf("final metrics are not scraped during the linger, took: %v, scraped: %v", time.Since(start), scraped)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("metrics endpoint should be closed after the linger")
+	}
+}
+
+type finishReporter struct {
+	benchmarker.BaseReporter
+	done chan struct{}
+}
+
+func (r *finishReporter) Finish(rp benchmarker.Report) error {
+	close(r.done)
+	return nil
+}
+
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(batch []benchmarker.Benchmark) error {
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Flush() error { return nil }
+
+func TestStartBenchmarkSinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		mu          sync.Mutex
+		influxLines []string
+		otlpBodies  [][]byte
+	)
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		buf, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		influxLines = append(influxLines, strings.Split(strings.TrimSpace(string(buf)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+	otlp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		otlpBodies = append(otlpBodies, buf)
+		mu.Unlock()
+	}))
+	defer otlp.Close()
+
+	influxSink, err := benchmarker.NewInfluxSink(benchmarker.InfluxSinkSpec{Url: influx.URL + "/api/v2/write?precision=ns", Token: "abc",
+		Tags: map[string]string{"env": "test run"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otlpSink, err := benchmarker.NewOtlpSink(benchmarker.OtlpSinkSpec{Url: otlp.URL + "/v1/metrics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n atomic.Int64
+	spec := benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Round:             50,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		Sinks:             []benchmarker.Sink{influxSink, otlpSink},
+		SinkBatchSize:     30,
+		BuildReqFunc: func() (*http.Request, error) {
+			url := srv.URL
+			if n.Add(1)%4 == 0 {
+				url += "?fail=1"
+			}
+			return http.NewRequest(http.MethodGet, url, nil)
+		},
+	}
+	_, stats, err := benchmarker.StartBenchmark(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats.Sinks {
+		if s.Written != 100 || s.Failed != 0 || s.Dropped != 0 {
+			t.Fatalf("unexpected sink stats: %+v", s)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(influxLines) != 100 {
+		t.Fatalf("expected 100 points, got %d", len(influxLines))
+	}
+	for _, l := range influxLines {
+		if !strings.HasPrefix(l, "benchmarker,status=") || !strings.Contains(l, `,env=test\ run took_ns=`) || !strings.Contains(l, "i,corrected_took_ns=") {
+			t.Fatalf("unexpected line: %v", l)
+		}
+	}
+
+	if len(otlpBodies) < 4 { // 100 records in batches of at most 30
+		t.Fatalf("expected at least 4 exports, got %d", len(otlpBodies))
+	}
+	var last struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string
+					Sum  struct {
+						DataPoints []struct {
+							AsInt string
+						}
+					}
+					Histogram struct {
+						DataPoints []struct {
+							Count        string
+							BucketCounts []string
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(otlpBodies[len(otlpBodies)-1], &last); err != nil {
+		t.Fatal(err)
+	}
+	metrics := last.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 || metrics[0].Name != "benchmarker.requests" || metrics[1].Name != "benchmarker.request.duration" {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+	total := 0
+	for _, dp := range metrics[0].Sum.DataPoints {
+		v, _ := strconv.Atoi(dp.AsInt)
+		total += v
+	}
+	if len(metrics[0].Sum.DataPoints) != 2 || total != 100 || metrics[1].Histogram.DataPoints[0].Count != "100" {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+
+	// slow sink never blocks the workers, records are dropped instead
+	slow := &blockingSink{release: make(chan struct{})}
+	spec.Sinks = []benchmarker.Sink{slow}
+	spec.SinkBatchSize = 1
+	spec.SinkBufferSize = 10
+	time.AfterFunc(time.Second, func() { close(slow.release) })
+	_, stats, err = benchmarker.StartBenchmark(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stats.Sinks[0]
+	if s.Dropped < 1 || s.Written+s.Dropped != 100 || stats.TotalTime >= time.Second {
+		t.Fatalf("unexpected sink stats: %+v", s)
+	}
+}
+
+func TestInfluxSinkUniqueTimestamps(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(buf)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	sink, err := benchmarker.NewInfluxSink(benchmarker.InfluxSinkSpec{Url: influx.URL + "/api/v2/write?precision=ns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// requests sent in the same microsecond are all in the same series, each of them is still a separate point,
+	// retry until some of the requests are sent in the same microsecond, e.g., it's slower with -race
+	var bench []benchmarker.Benchmark
+	for i := 0; i < 10; i++ {
+		mu.Lock()
+		lines = nil
+		mu.Unlock()
+		bench, _, err = benchmarker.StartFuncBenchmark(benchmarker.BenchmarkSpec{
+			Concurrent:        4,
+			Round:             2000,
+			DisableWarmup:     true,
+			DisablePlotGraphs: true,
+			DisableOutputFile: true,
+			Sinks:             []benchmarker.Sink{sink},
+		}, func(ctx context.Context) benchmarker.Result {
+			return benchmarker.Result{HttpStatus: 200, Success: true}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sharesMicrosecond(bench) {
+			break
+		}
+	}
+	if !sharesMicrosecond(bench) {
+		t.Skip("no requests are sent in the same microsecond")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	points := map[string]bool{}
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		points[fields[0]+" "+fields[len(fields)-1]] = true // series and timestamp identify the point
+	}
+	if len(lines) != len(bench) || len(points) != len(bench) {
+		t.Fatalf("expected %d unique points, got %d lines, %d unique points", len(bench), len(lines), len(points))
+	}
+}
+
+func sharesMicrosecond(bench []benchmarker.Benchmark) bool {
+	seen := make(map[int64]bool, len(bench))
+	for _, b := range bench {
+		if seen[b.Timestamp] {
+			return true
+		}
+		seen[b.Timestamp] = true
+	}
+	return false
+}
+
+type recordingReporter struct {
+	benchmarker.BaseReporter
+	mu        sync.Mutex
+	started   bool
+	records   int
+	snapshots []benchmarker.Snapshot
+	report    *benchmarker.Report
+}
+
+func (r *recordingReporter) Start(run benchmarker.RunInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = !run.StartTime.IsZero() && run.Spec.Concurrent == 2
+	return nil
+}
+
+func (r *recordingReporter) Record(b *benchmarker.Benchmark) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records++
+}
+
+func (r *recordingReporter) Snapshot(s benchmarker.Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshots = append(r.snapshots, s)
+}
+
+func (r *recordingReporter) Finish(rp benchmarker.Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report = &rp
+	return nil
+}
+
+type failingReporter struct {
+	benchmarker.BaseReporter
+}
+
+func (failingReporter) Start(run benchmarker.RunInfo) error {
+	return errors.New("not ready")
+}
+
+func TestStartBenchmarkReporters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	var n atomic.Int64
+	rep := &recordingReporter{}
+	spec := benchmarker.BenchmarkSpec{
+		Concurrent:         2,
+		Duration:           500 * time.Millisecond,
+		StreamStats:        true,
+		DisablePlotGraphs:  true,
+		DataOutputFilename: filepath.Join(t.TempDir(), "data.txt"),
+		Reporters:          []benchmarker.Reporter{rep},
+		BuildReqFunc: func() (*http.Request, error) {
+			url := srv.URL
+			if n.Add(1)%10 == 0 {
+				url += "?fail=1"
+			}
+			return http.NewRequest(http.MethodGet, url, nil)
+		},
+	}
+	_, stats, err := benchmarker.StartBenchmark(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if !rep.started {
+		t.Fatal("reporter is not started")
+	}
+	if rep.records != stats.TotalRequests {
+		t.Fatalf("expected %d records, got %d", stats.TotalRequests, rep.records)
+	}
+	if rep.report == nil {
+		t.Fatal("reporter is not finished")
+	}
+	if rep.report.Stats.TotalRequests != stats.TotalRequests || len(rep.report.Benchmarks) != stats.TotalRequests {
+		t.Fatalf("unexpected report, requests: %d, records: %d", rep.report.Stats.TotalRequests, len(rep.report.Benchmarks))
+	}
+	if len(rep.snapshots) > 0 {
+		t.Fatalf("unexpected snapshots, default interval is longer than the benchmark: %+v", rep.snapshots)
+	}
+
+	// data file is still written by the built-in reporter
+	buf, err := os.ReadFile(spec.DataOutputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "--------- Latency") {
+		t.Fatalf("unexpected data file: %s", buf)
+	}
+
+	// snapshots are taken every ProgressInterval
+	rep = &recordingReporter{}
+	spec.Reporters = []benchmarker.Reporter{rep}
+	spec.ProgressInterval = 100 * time.Millisecond
+	spec.DisableOutputFile = true
+	if _, _, err = benchmarker.StartBenchmark(spec); err != nil {
+		t.Fatal(err)
+	}
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if len(rep.snapshots) < 2 {
+		t.Fatalf("expected at least 2 snapshots, got %d", len(rep.snapshots))
+	}
+	last := rep.snapshots[len(rep.snapshots)-1]
+	if last.Requests < 1 || last.Requests < rep.snapshots[0].Requests || last.Elapsed <= rep.snapshots[0].Elapsed || last.StatusCount[200] < 1 {
+		t.Fatalf("unexpected snapshot: %+v", last)
+	}
+
+	// benchmark is aborted if the reporter fails to start
+	spec.Reporters = []benchmarker.Reporter{failingReporter{}}
+	if _, _, err = benchmarker.StartBenchmark(spec); err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Fatalf("expected start error, got %v", err)
+	}
+}
+
+type slowReporter struct {
+	recordingReporter
+}
+
+func (r *slowReporter) Record(b *benchmarker.Benchmark) {
+	time.Sleep(10 * time.Millisecond)
+	r.recordingReporter.Record(b)
+}
+
+func TestStartBenchmarkSlowReporter(t *testing.T) {
+	rep := &slowReporter{}
+	_, stats, err := benchmarker.StartFuncBenchmark(benchmarker.BenchmarkSpec{
+		Concurrent:        2,
+		Round:             50,
+		DisablePlotGraphs: true,
+		DisableOutputFile: true,
+		Reporters:         []benchmarker.Reporter{rep},
+	}, func(ctx context.Context) benchmarker.Result {
+		return benchmarker.Result{HttpStatus: 200, Success: true}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the workers are not blocked by the reporter, all the records are still passed to it before Finish
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if stats.TotalTime >= 500*time.Millisecond {
+		t.Fatalf("workers are blocked by the reporter, total time: %v", stats.TotalTime)
+	}
+	if rep.records != 100 || rep.report == nil {
+		t.Fatalf("expected 100 records before Finish, got %d", rep.records)
+	}
+}
@@ -0,0 +1,228 @@
+package benchmarker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+)
+
+const (
+	// exit code of benchmarker CLI when any threshold is breached.
+	ExitCodeThresholdBreached = 99
+)
+
+var (
+	ErrThresholdBreached = errs.NewErrf("Threshold breached").WithCode("THRESHOLD_BREACHED")
+
+	thresholdOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+)
+
+// Threshold (SLO) evaluated against Stats after the benchmark, e.g., 'p99 < 200ms', 'error_rate < 0.01', 'throughput > 500'.
+//
+// Supported metrics:
+//
+//   - min, max, avg, med (or median), p75, p90, p95, p99: latency, value must be a duration (e.g., 200ms).
+//   - corrected_min, corrected_max, ..., corrected_p99: coordinated omission corrected latency, only available in Rate mode.
+//   - error_rate: ratio of unsuccessful requests (0-1), value can also be a percentage (e.g., 1%).
+//   - throughput: req/sec.
+//   - total_requests: number of requests sent.
+type Threshold struct {
+	Expr   string
+	Metric string
+	Op     string
+	Value  float64 // latency is in nanoseconds
+}
+
+type ThresholdResult struct {
+	Threshold Threshold
+	Actual    float64 // latency is in nanoseconds
+	Available bool    // whether the metric is available, e.g., corrected latency is only available in Rate mode
+	Pass      bool
+}
+
+func (t Threshold) isLatency() bool {
+	_, ok := latencyMetric(strings.TrimPrefix(t.Metric, "corrected_"))
+	return ok
+}
+
+func (t Threshold) formatValue(v float64) string {
+	if t.isLatency() {
+		return time.Duration(v).String()
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (r ThresholdResult) String() string {
+	res := "PASS"
+	if !r.Pass {
+		res = "FAIL"
+	}
+	actual := "n/a"
+	if r.Available {
+		actual = r.Threshold.formatValue(r.Actual)
+	}
+	return fmt.Sprintf("%s  %s (actual: %s)", res, r.Threshold.Expr, actual)
+}
+
+// Parse threshold expressions, e.g., 'p99 < 200ms'.
+func ParseThresholds(exprs []string) ([]Threshold, error) {
+	thresholds := make([]Threshold, 0, len(exprs))
+	for _, e := range exprs {
+		if util.IsBlankStr(e) {
+			continue
+		}
+		t, err := ParseThreshold(e)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// Parse threshold expression in format '<metric> <op> <value>', e.g., 'p99 < 200ms'.
+func ParseThreshold(expr string) (Threshold, error) {
+	expr = strings.TrimSpace(expr)
+	t := Threshold{Expr: expr}
+
+	i := strings.IndexAny(expr, "<>=!")
+	if i < 0 {
+		return t, errs.NewErrf("Invalid threshold '%v', missing operator, e.g., 'p99 < 200ms'", expr)
+	}
+	for _, op := range thresholdOps {
+		if strings.HasPrefix(expr[i:], op) {
+			t.Op = op
+			break
+		}
+	}
+	if t.Op == "" {
+		return t, errs.NewErrf("Invalid threshold '%v', operator must be one of %v", expr, strings.Join(thresholdOps, ", "))
+	}
+	t.Metric = strings.ToLower(strings.TrimSpace(expr[:i]))
+	val := strings.TrimSpace(expr[i+len(t.Op):])
+	if t.Metric == "" || val == "" {
+		return t, errs.NewErrf("Invalid threshold '%v', should be '<metric> <op> <value>', e.g., 'p99 < 200ms'", expr)
+	}
+
+	switch {
+	case t.isLatency():
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return t, errs.NewErrf("Invalid threshold '%v', value of %v must be a duration, e.g., 200ms", expr, t.Metric)
+		}
+		t.Value = float64(d)
+	case t.Metric == "error_rate" && strings.HasSuffix(val, "%"):
+		v, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+		if err != nil {
+			return t, errs.NewErrf("Invalid threshold '%v', value must be a number", expr)
+		}
+		t.Value = v / 100
+	case util.EqualAnyStr(t.Metric, "error_rate", "throughput", "total_requests"):
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return t, errs.NewErrf("Invalid threshold '%v', value must be a number", expr)
+		}
+		t.Value = v
+	default:
+		return t, errs.NewErrf("Invalid threshold '%v', unknown metric '%v'", expr, t.Metric)
+	}
+	return t, nil
+}
+
+// check whether the metrics of the thresholds are available for the spec, e.g., corrected latency is only available in Rate mode.
+func checkThresholds(thresholds []Threshold, spec BenchmarkSpec) error {
+	for _, t := range thresholds {
+		if strings.HasPrefix(t.Metric, "corrected_") && spec.Rate <= 0 {
+			return errs.NewErrf("Invalid threshold '%v', metric %v is only available in Rate mode", t.Expr, t.Metric)
+		}
+	}
+	return nil
+}
+
+// latency metric of LatencyStats, e.g., 'p99'.
+func latencyMetric(metric string) (func(ls LatencyStats) time.Duration, bool) {
+	switch metric {
+	case "min":
+		return func(ls LatencyStats) time.Duration { return ls.Min }, true
+	case "max":
+		return func(ls LatencyStats) time.Duration { return ls.Max }, true
+	case "avg":
+		return func(ls LatencyStats) time.Duration { return ls.Avg }, true
+	case "med", "median":
+		return func(ls LatencyStats) time.Duration { return ls.Med }, true
+	}
+	for _, pv := range percentileValues {
+		if metric == fmt.Sprintf("p%d", pv) {
+			return func(ls LatencyStats) time.Duration { return ls.Percentiles[pv] }, true
+		}
+	}
+	return nil, false
+}
+
+// Evaluate the thresholds against the stats.
+func EvalThresholds(thresholds []Threshold, stats Stats) []ThresholdResult {
+	res := make([]ThresholdResult, 0, len(thresholds))
+	for _, t := range thresholds {
+		r := ThresholdResult{Threshold: t}
+		r.Actual, r.Available = thresholdActual(t.Metric, stats)
+		r.Pass = r.Available && compareThreshold(r.Actual, t.Op, t.Value)
+		res = append(res, r)
+	}
+	return res
+}
+
+func thresholdActual(metric string, stats Stats) (float64, bool) {
+	switch metric {
+	case "error_rate":
+		return stats.ErrorRate(), true
+	case "throughput":
+		return stats.Throughput, true
+	case "total_requests":
+		return float64(stats.TotalRequests), true
+	}
+	if m, ok := strings.CutPrefix(metric, "corrected_"); ok {
+		f, ok := latencyMetric(m)
+		if !ok || stats.Corrected == nil {
+			return 0, false
+		}
+		return float64(f(*stats.Corrected)), true
+	}
+	f, ok := latencyMetric(metric)
+	if !ok {
+		return 0, false
+	}
+	return float64(f(stats.latencyStats())), true
+}
+
+func compareThreshold(actual float64, op string, expected float64) bool {
+	switch op {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "==":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	}
+	return false
+}
+
+// thresholds that are breached.
+func failedThresholds(res []ThresholdResult) []string {
+	var failed []string
+	for _, r := range res {
+		if !r.Pass {
+			failed = append(failed, r.Threshold.Expr)
+		}
+	}
+	return failed
+}
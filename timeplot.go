@@ -0,0 +1,169 @@
+package benchmarker
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/curtisnewbie/miso/util"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+const (
+	defPlotBucketWidth = time.Second
+)
+
+// records completed within the same time bucket.
+type timeBucket struct {
+	Offset        time.Duration // start of the bucket, since the start of the benchmark
+	Width         time.Duration // width of the bucket, the last bucket may be wider or narrower
+	Took          []time.Duration
+	CorrectedTook []time.Duration
+	Fail          int
+}
+
+// requests/sec completed in the bucket.
+func (b *timeBucket) throughput() float64 {
+	if b.Width <= 0 {
+		return 0
+	}
+	return float64(len(b.Took)) / b.Width.Seconds()
+}
+
+// error rate (%) of the bucket.
+func (b *timeBucket) errorRate() float64 {
+	if len(b.Took) < 1 {
+		return 0
+	}
+	return float64(b.Fail) / float64(len(b.Took)) * 100
+}
+
+// group records by the time they are completed, bench is sorted by timestamp.
+//
+// The first bucket starts at the timestamp of the first record, empty buckets are included.
+func toTimeBuckets(bench []Benchmark, width time.Duration) []timeBucket {
+	if len(bench) < 1 || width <= 0 {
+		return nil
+	}
+	start := time.UnixMicro(bench[0].Timestamp)
+	var last time.Duration
+	for i := range bench {
+		last = max(last, time.UnixMicro(bench[i].Timestamp).Add(bench[i].Took).Sub(start))
+	}
+
+	// the trailing partial bucket is merged into the last one, so that it doesn't look like a sudden drop of throughput
+	buckets := make([]timeBucket, max(1, int(last/width)))
+	for i := range buckets {
+		buckets[i].Offset = time.Duration(i) * width
+		buckets[i].Width = width
+	}
+	if lb := &buckets[len(buckets)-1]; last > lb.Offset {
+		lb.Width = last - lb.Offset
+	}
+	for i := range bench {
+		b := &bench[i]
+		bk := &buckets[min(int(time.UnixMicro(b.Timestamp).Add(b.Took).Sub(start)/width), len(buckets)-1)]
+		bk.Took = append(bk.Took, b.Took)
+		bk.CorrectedTook = append(bk.CorrectedTook, b.CorrectedTook)
+		if !b.Success {
+			bk.Fail++
+		}
+	}
+	return buckets
+}
+
+// percentile of each bucket, buckets without records are skipped.
+func bucketPercentileXYs(buckets []timeBucket, p float64, corrected bool) plotter.XYs {
+	pts := make(plotter.XYs, 0, len(buckets))
+	for i := range buckets {
+		vals := buckets[i].Took
+		if corrected {
+			vals = buckets[i].CorrectedTook
+		}
+		if len(vals) < 1 {
+			continue
+		}
+		sorted := slices.Clone(vals)
+		slices.Sort(sorted)
+		pts = append(pts, plotter.XY{X: buckets[i].Offset.Seconds(), Y: durMs(sorted[percentileIndex(len(sorted), p)])})
+	}
+	return pts
+}
+
+func bucketXYs(buckets []timeBucket, f func(b *timeBucket) float64) plotter.XYs {
+	pts := make(plotter.XYs, 0, len(buckets))
+	for i := range buckets {
+		pts = append(pts, plotter.XY{X: buckets[i].Offset.Seconds(), Y: f(&buckets[i])})
+	}
+	return pts
+}
+
+// plot throughput, latency percentiles and error rate over time, bench is sorted by timestamp.
+func plotTimeGraphs(spec BenchmarkSpec, bench []Benchmark, stats Stats) error {
+	buckets := toTimeBuckets(bench, spec.PlotBucketWidth)
+	if len(buckets) < 1 {
+		return nil
+	}
+	titleStats := fmt.Sprintf("(Bucket: %v, Total %d Requests, Concurrency: %v, Throughput: %.0f req/sec, Error Rate: %.2f%%)",
+		spec.PlotBucketWidth, len(bench), spec.Concurrent, stats.Throughput, stats.ErrorRate()*100)
+
+	xlabel := "X - Seconds Since Start"
+	throughput := newPlot(stats, spec.benchmarkTime+" - Throughput Over Time Plot "+titleStats, xlabel, "Throughput (req/sec)")
+	if err := plotutil.AddLinePoints(throughput, "Throughput", bucketXYs(buckets, (*timeBucket).throughput)); err != nil {
+		return err
+	}
+	throughput.X.Min, throughput.Y.Min = 0, 0
+	if err := savePlot(spec, throughput, spec.PlotThroughputFilename); err != nil {
+		return err
+	}
+
+	latency := newPlot(stats, spec.benchmarkTime+" - Latency Percentiles Over Time Plot "+titleStats, xlabel, "Request Latency (ms)")
+	vs := []any{
+		"P50", bucketPercentileXYs(buckets, 50, false),
+		"P90", bucketPercentileXYs(buckets, 90, false),
+		"P99", bucketPercentileXYs(buckets, 99, false),
+	}
+	if stats.Corrected != nil {
+		vs = append(vs, "Corrected P99", bucketPercentileXYs(buckets, 99, true))
+	}
+	if err := plotutil.AddLinePoints(latency, vs...); err != nil {
+		return err
+	}
+	latency.X.Min, latency.Y.Min = 0, 0
+	if err := savePlot(spec, latency, spec.PlotLatencyOverTimeFilename); err != nil {
+		return err
+	}
+
+	errRate := newPlot(stats, spec.benchmarkTime+" - Error Rate Over Time Plot "+titleStats, xlabel, "Error Rate (%)")
+	if err := plotutil.AddLinePoints(errRate, "Error Rate", bucketXYs(buckets, (*timeBucket).errorRate)); err != nil {
+		return err
+	}
+	errRate.X.Min, errRate.Y.Min = 0, 0
+	errRate.Y.Max = 101
+	return savePlot(spec, errRate, spec.PlotErrorRateFilename)
+}
+
+func newPlot(stats Stats, title string, xlabel string, ylabel string) *plot.Plot {
+	if stats.Interrupted {
+		title += " (Interrupted, Partial Results)"
+	}
+	p := plot.New()
+	p.Title.Text = "\n" + title
+	p.Title.Padding = 0.1 * vg.Inch
+	p.X.Label.Text = "\n" + xlabel + "\n"
+	p.X.Label.Padding = 0.1 * vg.Inch
+	p.Y.Label.Text = "\n" + ylabel + "\n"
+	p.Y.Label.Padding = 0.1 * vg.Inch
+	return p
+}
+
+func savePlot(spec BenchmarkSpec, p *plot.Plot, fname string) error {
+	if err := p.Save(spec.PlotWidth, spec.PlotHeight, fname); err != nil {
+		return err
+	}
+	util.Printlnf("Generated plot graph: %v", fname)
+	return nil
+}
@@ -0,0 +1,90 @@
+package benchmarker
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timing breakdown of a http request, captured using httptrace.
+type httpTiming struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// callbacks may be invoked on other goroutines (e.g., dialing), so they are guarded by the mutex.
+func (t *httpTiming) clientTrace() *httptrace.ClientTrace {
+	now := func(p *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		*p = time.Now()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connectDone) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+// fill timing fields of the Benchmark, end is the time when the response body is fully read.
+func (t *httpTiming) fill(b *Benchmark, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b.DNSLookup = between(t.dnsStart, t.dnsDone)
+	b.TCPConnect = between(t.connectStart, t.connectDone)
+	b.TLSHandshake = between(t.tlsStart, t.tlsDone)
+	b.TTFB = between(t.wroteRequest, t.firstByte)
+	b.BodyTransfer = between(t.firstByte, end)
+}
+
+func between(start time.Time, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+type timingPhase struct {
+	Name  string
+	Value func(b *Benchmark) time.Duration
+}
+
+var (
+	timingPhases = []timingPhase{
+		{Name: "dns_lookup", Value: func(b *Benchmark) time.Duration { return b.DNSLookup }},
+		{Name: "tcp_connect", Value: func(b *Benchmark) time.Duration { return b.TCPConnect }},
+		{Name: "tls_handshake", Value: func(b *Benchmark) time.Duration { return b.TLSHandshake }},
+		{Name: "ttfb", Value: func(b *Benchmark) time.Duration { return b.TTFB }},
+		{Name: "body_transfer", Value: func(b *Benchmark) time.Duration { return b.BodyTransfer }},
+	}
+)
+
+// calculate stats of each timing phase, phases that didn't happen (e.g., connection reused) are excluded.
+func computePhaseStats(bench []Benchmark) map[string]LatencyStats {
+	ps := make(map[string]LatencyStats, len(timingPhases))
+	vals := make([]time.Duration, 0, len(bench))
+	for _, p := range timingPhases {
+		vals = vals[:0]
+		for i := range bench {
+			if v := p.Value(&bench[i]); v > 0 {
+				vals = append(vals, v)
+			}
+		}
+		ps[p.Name] = durationStats(vals)
+	}
+	return ps
+}
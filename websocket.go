@@ -0,0 +1,472 @@
+package benchmarker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/curtisnewbie/miso/encoding/json"
+	"github.com/curtisnewbie/miso/util"
+	"github.com/curtisnewbie/miso/util/errs"
+	"github.com/curtisnewbie/miso/util/expr"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defWsReplyTimeout     = 10 * time.Second
+	defWsHandshakeTimeout = 10 * time.Second
+)
+
+// WebSocket benchmark, each worker opens a long-lived connection, sends messages and matches the replies.
+//
+// Each message is recorded as a request, Took is the round-trip latency (from the message is sent until the reply is received),
+// messages without reply within ReplyTimeout are dropped (unsuccessful). Benchmark.HttpStatus is always 0.
+//
+// Concurrent is the number of connections. If BenchmarkSpec.Rate is specified, it's the total message rate of all connections,
+// messages are sent on a fixed timeline regardless of the replies, and Round becomes the total number of messages.
+// Otherwise, each connection sends the next message after the reply of the previous one is received, and Round is the number of
+// messages sent on each connection.
+type WebSocketSpec struct {
+	// required, url, e.g., 'ws://localhost:8080/chat'.
+	Url string
+
+	// optional, headers of the handshake request.
+	Header http.Header
+
+	// required, func to build the message.
+	BuildMsgFunc func() ([]byte, error)
+
+	// optional, json path of the field used to match replies with messages (e.g., 'id', 'meta.reqId'), both messages and replies
+	// should be json. By default, replies are matched in the order the messages are sent.
+	//
+	// Without CorrelationField, a reply is always matched with the oldest pending message, so a late reply to a dropped message
+	// is credited to the next message with a wrong round-trip latency. It's required if BenchmarkSpec.Rate is specified,
+	// since messages are sent without waiting for the replies.
+	CorrelationField string
+
+	// optional, max time waiting for the reply, by default 10s.
+	ReplyTimeout time.Duration
+
+	// optional, max time of the handshake when the connection is established, by default 10s.
+	HandshakeTimeout time.Duration
+}
+
+// Stats of WebSocket connections and messages.
+type WebSocketStats struct {
+	Connections       int          // connections established
+	FailedConnections int          // connections failed to establish
+	Connect           LatencyStats // time to establish connection, including the handshake
+	Sent              int          // messages sent
+	Received          int          // replies matched with messages
+	Dropped           int          // messages without reply within ReplyTimeout (or the connection is closed)
+	Failed            int          // messages failed to build or send
+	Unmatched         int          // replies that don't match any message
+}
+
+// collects connect time and message counters of all the connections.
+type wsCollector struct {
+	mu      sync.Mutex
+	connect []time.Duration
+	stats   WebSocketStats
+}
+
+func (c *wsCollector) update(f func(st *WebSocketStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(&c.stats)
+}
+
+func (c *wsCollector) build() *WebSocketStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Connect = durationStats(c.connect)
+	return &st
+}
+
+type wsPending struct {
+	key          string
+	sentUnixNano int64 // see uniqueUnixNano
+	sent         time.Time
+	intended     time.Time
+}
+
+// a long-lived connection (i.e., virtual user).
+type wsConn struct {
+	w        *worker
+	ws       *WebSocketSpec
+	conn     *websocket.Conn
+	coll     *wsCollector
+	corrPath []any
+
+	mu      sync.Mutex
+	pending []*wsPending // in the order the messages are sent
+	replied chan struct{}
+	closed  chan struct{} // closed when the reader exits
+}
+
+// create WebSocketSpec for the CLI, msgExpr builds each message and headerExpr builds the handshake headers.
+func newCliWebSocketSpec(url string, msgExpr *expr.Expr[map[string]any], headerExpr *expr.Expr[map[string]any],
+	env map[string]any) (*WebSocketSpec, error) {
+
+	ws := &WebSocketSpec{Url: url, Header: http.Header{}}
+	if headerExpr != nil {
+		hv, err := headerExpr.Eval(env)
+		if err != nil {
+			return nil, errs.WrapErrf(err, "failed to build WebSocket handshake headers")
+		}
+		req := &http.Request{Header: ws.Header}
+		addHeaders(req, hv)
+	}
+	ws.BuildMsgFunc = func() ([]byte, error) {
+		if msgExpr == nil {
+			return []byte("{}"), nil
+		}
+		out, err := msgExpr.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return json.WriteJson(out)
+	}
+	return ws, nil
+}
+
+// validate WebSocketSpec and fill default values.
+func prepareWebSocket(spec *BenchmarkSpec) error {
+	ws := *spec.WebSocket
+	if ws.Url == "" {
+		return errs.NewErrf("WebSocket url is required")
+	}
+	if ws.BuildMsgFunc == nil {
+		return errs.NewErrf("WebSocket BuildMsgFunc is required")
+	}
+	if len(spec.Stages) > 0 {
+		return errs.NewErrf("Stages are not supported in WebSocket mode")
+	}
+	if ws.ReplyTimeout <= 0 {
+		ws.ReplyTimeout = defWsReplyTimeout
+	}
+	if ws.HandshakeTimeout <= 0 {
+		ws.HandshakeTimeout = defWsHandshakeTimeout
+	}
+	if ws.CorrelationField == "" && spec.Rate > 0 {
+		return errs.NewErrf("WebSocket CorrelationField is required in Rate mode, replies can't be matched by the order of messages")
+	}
+	if ws.CorrelationField != "" {
+		if _, err := parseJsonPath(ws.CorrelationField); err != nil {
+			return errs.WrapErrf(err, "invalid WebSocket correlation field")
+		}
+	}
+	spec.WebSocket = &ws
+	spec.wsCollector = &wsCollector{}
+	return nil
+}
+
+// each worker opens a connection, messages are sent once all the connections are established.
+func runWebSocket(spec BenchmarkSpec, durBased bool, rec *recorder) ([]Benchmark, time.Time) {
+	pool := util.NewAsyncPool(spec.Concurrent, spec.Concurrent)
+	aw := util.NewAwaitFutures[[]Benchmark](pool)
+
+	var connWg sync.WaitGroup
+	connWg.Add(spec.Concurrent)
+	var startTimeOnce sync.Once
+	var startTime time.Time
+
+	var interval time.Duration // interval between messages on each connection, only in Rate mode
+	if spec.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(spec.Concurrent) / spec.Rate)
+	}
+
+	for i := 0; i < spec.Concurrent; i++ {
+		wi := i
+		aw.SubmitAsync(func() ([]Benchmark, error) {
+			rounds := spec.Round
+			if spec.Rate > 0 {
+				rounds = spec.Round / spec.Concurrent
+				if wi < spec.Round%spec.Concurrent {
+					rounds++
+				}
+			}
+			capacity := rounds
+			if durBased {
+				capacity = spec.SingleWorkerResultQueueSize
+			}
+			c := &wsConn{w: newWorker(&spec, rec, capacity), ws: spec.WebSocket, coll: spec.wsCollector,
+				replied: make(chan struct{}, 1), closed: make(chan struct{})}
+			if spec.WebSocket.CorrelationField != "" {
+				c.corrPath, _ = parseJsonPath(spec.WebSocket.CorrelationField)
+			}
+			err := func() error {
+				defer connWg.Done()
+				return c.connect()
+			}()
+			connWg.Wait() // synchronize all of them
+
+			startTimeOnce.Do(func() { startTime = time.Now() })
+			if err != nil {
+				util.DebugPrintlnf(spec.DebugLog, "Worker-%d failed to connect: %v", wi, err)
+				return nil, nil
+			}
+			defer c.conn.Close()
+			go c.read()
+			util.DebugPrintlnf(spec.DebugLog, "Worker-%d start sending messages: %v", wi, time.Now())
+
+			// spread connections evenly on the timeline
+			start := startTime.Add(interval * time.Duration(wi) / time.Duration(spec.Concurrent))
+			for j := 0; spec.ctx.Err() == nil; j++ {
+				if durBased {
+					if time.Since(startTime) > spec.Duration {
+						break
+					}
+				} else if j >= rounds {
+					break
+				}
+				var intended time.Time
+				if interval > 0 {
+					intended = start.Add(interval * time.Duration(j))
+					if durBased && intended.Sub(startTime) > spec.Duration {
+						break
+					}
+					if !sleepCtx(spec.ctx, time.Until(intended)) {
+						break
+					}
+				}
+				if err := c.send(intended); err != nil {
+					break // no more messages or connection is broken
+				}
+				if interval <= 0 {
+					c.awaitReplies()
+				}
+			}
+			c.awaitReplies()
+			c.close()
+			return c.w.records, nil
+		})
+	}
+
+	var size int
+	if !durBased {
+		size = spec.Concurrent * spec.Round
+	} else {
+		size = spec.Concurrent * spec.SingleWorkerResultQueueSize
+	}
+	return collectBenchmarks(aw, rec, size), startTime
+}
+
+func (c *wsConn) connect() error {
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: c.ws.HandshakeTimeout}
+	start := time.Now()
+	conn, _, err := dialer.DialContext(c.w.spec.ctx, c.ws.Url, c.ws.Header)
+	took := time.Since(start)
+	if err != nil {
+		c.coll.update(func(st *WebSocketStats) { st.FailedConnections++ })
+		return err
+	}
+	c.conn = conn
+	c.coll.update(func(st *WebSocketStats) { st.Connections++ })
+	c.coll.mu.Lock()
+	c.coll.connect = append(c.coll.connect, took)
+	c.coll.mu.Unlock()
+	return nil
+}
+
+// send message, error is returned if there are no more messages or the connection is broken.
+func (c *wsConn) send(intended time.Time) error {
+	now := time.Now()
+	if intended.IsZero() || intended.After(now) {
+		intended = now
+	}
+	p := &wsPending{sentUnixNano: uniqueUnixNano(now), sent: now, intended: intended}
+
+	msg, err := c.ws.BuildMsgFunc()
+	if err != nil {
+		if errors.Is(err, ErrNoMoreRequests) {
+			return err
+		}
+		c.fail(p, err)
+		return nil
+	}
+	if c.corrPath != nil {
+		if p.key, err = c.correlationKey(msg); err != nil {
+			c.fail(p, err)
+			return nil
+		}
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, p)
+	c.mu.Unlock()
+	c.w.rec.metrics.addInFlight(1)
+
+	if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		c.mu.Lock()
+		i := c.indexOf(p)
+		if i > -1 {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+		}
+		c.mu.Unlock()
+		if i > -1 {
+			c.w.rec.metrics.addInFlight(-1)
+			c.fail(p, err)
+		}
+		return err
+	}
+	c.coll.update(func(st *WebSocketStats) { st.Sent++ })
+	c.sweep(false)
+	return nil
+}
+
+// read replies and match them with the pending messages until the connection is closed.
+func (c *wsConn) read() {
+	defer close(c.closed)
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		end := time.Now()
+
+		var key string
+		if c.corrPath != nil {
+			if key, err = c.correlationKey(msg); err != nil {
+				c.coll.update(func(st *WebSocketStats) { st.Unmatched++ })
+				continue
+			}
+		}
+		c.mu.Lock()
+		i := -1
+		for j, p := range c.pending {
+			if c.corrPath == nil || p.key == key {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			c.mu.Unlock()
+			c.coll.update(func(st *WebSocketStats) { st.Unmatched++ })
+			continue
+		}
+		p := c.pending[i]
+		c.pending = append(c.pending[:i], c.pending[i+1:]...)
+		c.w.rec.metrics.addInFlight(-1)
+		c.recordLocked(p, end, true, nil)
+		c.mu.Unlock()
+		c.coll.update(func(st *WebSocketStats) { st.Received++ })
+
+		select {
+		case c.replied <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait until all the pending messages are replied or dropped, or the benchmark is interrupted.
+func (c *wsConn) awaitReplies() {
+	for {
+		c.mu.Lock()
+		if len(c.pending) < 1 {
+			c.mu.Unlock()
+			return
+		}
+		wait := time.Until(c.pending[0].sent.Add(c.ws.ReplyTimeout))
+		c.mu.Unlock()
+
+		select {
+		case <-c.replied:
+		case <-time.After(max(wait, 0)):
+			c.sweep(false)
+		case <-c.closed:
+			c.sweep(true)
+			return
+		case <-c.w.spec.ctx.Done():
+			return
+		}
+	}
+}
+
+// messages without reply within ReplyTimeout are dropped, all of them are dropped if the connection is closed.
+func (c *wsConn) sweep(all bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for n < len(c.pending) && (all || now.Sub(c.pending[n].sent) >= c.ws.ReplyTimeout) {
+		reason := fmt.Sprintf("dropped, no reply within %v", c.ws.ReplyTimeout)
+		if all {
+			reason = "dropped, connection is closed"
+		}
+		c.recordLocked(c.pending[n], now, false, map[string]any{"ERROR": reason})
+		n++
+	}
+	if n > 0 {
+		c.pending = c.pending[n:]
+		c.w.rec.metrics.addInFlight(-n)
+		c.coll.update(func(st *WebSocketStats) { st.Dropped += n })
+	}
+}
+
+func (c *wsConn) close() {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second):
+		_ = c.conn.Close() // make sure the reader exits before the records are returned
+		<-c.closed
+	}
+	if c.w.spec.ctx.Err() != nil {
+		// interrupted, messages still pending are discarded
+		c.mu.Lock()
+		c.w.rec.metrics.addInFlight(-len(c.pending))
+		c.pending = nil
+		c.mu.Unlock()
+		return
+	}
+	c.sweep(true)
+}
+
+func (c *wsConn) fail(p *wsPending, err error) {
+	c.coll.update(func(st *WebSocketStats) { st.Failed++ })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordLocked(p, time.Now(), false, map[string]any{"ERROR": err.Error()})
+}
+
+func (c *wsConn) recordLocked(p *wsPending, end time.Time, success bool, extra map[string]any) {
+	b := Benchmark{
+		Timestamp:         p.sentUnixNano / int64(time.Microsecond),
+		IntendedTimestamp: p.intended.UnixMicro(),
+		Took:              end.Sub(p.sent),
+		CorrectedTook:     end.Sub(p.intended),
+		Success:           success,
+		Extra:             extra,
+		sentUnixNano:      p.sentUnixNano,
+	}
+	c.w.record(&b)
+}
+
+func (c *wsConn) indexOf(p *wsPending) int {
+	for i, v := range c.pending {
+		if v == p {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *wsConn) correlationKey(msg []byte) (string, error) {
+	var v any
+	if err := json.ParseJson(msg, &v); err != nil {
+		return "", errs.WrapErrf(err, "message is not json")
+	}
+	key, ok := lookupJsonPath(v, c.corrPath)
+	if !ok {
+		return "", errs.NewErrf("correlation field '%v' not found", c.ws.CorrelationField)
+	}
+	if f, ok := key.(float64); ok && f == math.Trunc(f) {
+		return fmt.Sprintf("%.0f", f), nil
+	}
+	return fmt.Sprintf("%v", key), nil
+}